@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/job"
+)
+
+const (
+	commandArchive            = "archive"
+	commandRestore            = "restore"
+	commandVerify             = "verify"
+	commandListPartitions     = "list-partitions"
+	commandAudit              = "audit"
+	commandPollInquiry        = "poll-inquiry"
+	commandReconcileTransfers = "reconcile-transfers"
+	commandMockBank           = "mock-bank"
+	commandPayout             = "payout"
+	commandRelayOutbox        = "relay-outbox"
+	commandSettlementReport   = "settlement-report"
+)
+
+var commands = []string{commandArchive, commandRestore, commandVerify, commandListPartitions, commandAudit, commandPollInquiry, commandReconcileTransfers, commandMockBank, commandPayout, commandRelayOutbox, commandSettlementReport}
+
+// Exit codes for cron and Kubernetes Jobs.
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitCheckFailed = 3
+)
+
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+func isCommand(name string) bool {
+	for _, command := range commands {
+		if command == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runCLI parses "<command> [flags]" on top of the env/viper config and runs
+// the same code path as LambdaHandler.
+func runCLI(args []string) int {
+	config.InitTimeZone()
+
+	cfg, err := config.InitConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to initial config:", err)
+		return exitUsage
+	}
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cfg.Mode = args[0]
+		args = args[1:]
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = commandArchive
+	}
+	if !isCommand(cfg.Mode) {
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected one of %s\n", cfg.Mode, strings.Join(commands, ", "))
+		return exitUsage
+	}
+
+	flags := newFlagSet(cfg)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(flags.Args(), " "))
+		return exitUsage
+	}
+
+	err = run(context.Background(), cfg)
+	code := exitCode(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", cfg.Mode, err)
+	}
+	return code
+}
+
+func newFlagSet(cfg *config.Config) *flag.FlagSet {
+	flags := flag.NewFlagSet(cfg.Mode, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: goapp <%s> [flags]\n", strings.Join(commands, "|"))
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "log level: debug, info, warn, error")
+	flags.StringVar(&cfg.S3Config.BucketName, "bucket", cfg.S3Config.BucketName, "archive bucket")
+	flags.StringVar(&cfg.S3Config.Key, "key", cfg.S3Config.Key, "archive key template, %s is the partition name")
+	flags.StringVar(&cfg.AWSConfig.Region, "region", cfg.AWSConfig.Region, "AWS region")
+
+	flags.StringVar(&cfg.DBConfig.Host, "db-host", cfg.DBConfig.Host, "database host")
+	flags.StringVar(&cfg.DBConfig.Port, "db-port", cfg.DBConfig.Port, "database port")
+	flags.StringVar(&cfg.DBConfig.Name, "db-name", cfg.DBConfig.Name, "database name")
+	flags.StringVar(&cfg.DBConfig.Username, "db-user", cfg.DBConfig.Username, "database user")
+
+	flags.StringVar(&cfg.Partition.Scheme, "scheme", cfg.Partition.Scheme, "partition scheme: monthly, weekly or daily")
+	flags.StringVar(&cfg.Partition.From, "from", cfg.Partition.From, "first partition, 2006-01 or 2006-01-02")
+	flags.StringVar(&cfg.Partition.To, "to", cfg.Partition.To, "last partition (inclusive), 2006-01 or 2006-01-02")
+	flags.IntVar(&cfg.Partition.Count, "count", cfg.Partition.Count, "number of partitions starting at -from")
+	flags.IntVar(&cfg.Partition.Previous, "previous", cfg.Partition.Previous, "number of partitions before the current one")
+
+	flags.IntVar(&cfg.Quality.MaxRejectedRows, "max-rejected-rows", cfg.Quality.MaxRejectedRows, "fail a partition above this many rejected rows, negative disables")
+
+	flags.StringVar(&cfg.Restore.Table, "table", cfg.Restore.Table, "restore target table, %s is the partition name")
+	flags.BoolVar(&cfg.Restore.Create, "create", cfg.Restore.Create, "create the restore table like his_pricing if missing")
+	flags.BoolVar(&cfg.Verify.Source, "source", cfg.Verify.Source, "also compare archives with the partitions still in the database")
+
+	flags.BoolVar(&cfg.Audit.StoreDB, "store-db", cfg.Audit.StoreDB, "store the audit report in archive_audit_report")
+	flags.BoolVar(&cfg.Audit.PublishKafka, "publish-kafka", cfg.Audit.PublishKafka, "publish the audit report to Kafka")
+	flags.StringVar(&cfg.Audit.Topic, "topic", cfg.Audit.Topic, "Kafka topic for the audit report")
+
+	flags.DurationVar(&cfg.EFT.Poller.MinAge, "min-age", cfg.EFT.Poller.MinAge, "only poll transfers older than this")
+	flags.DurationVar(&cfg.EFT.Poller.Cutoff, "cutoff", cfg.EFT.Poller.Cutoff, "escalate transfers still unresolved after this")
+	flags.DurationVar(&cfg.EFT.Poller.Interval, "interval", cfg.EFT.Poller.Interval, "keep polling at this interval, 0 polls once")
+	flags.IntVar(&cfg.EFT.Poller.Batch, "batch", cfg.EFT.Poller.Batch, "transfers per poll")
+	flags.BoolVar(&cfg.EFT.Poller.PublishKafka, "publish-exceptions", cfg.EFT.Poller.PublishKafka, "also publish escalated transfers to Kafka")
+
+	flags.DurationVar(&cfg.EFT.Outbox.Interval, "relay-interval", cfg.EFT.Outbox.Interval, "keep relaying transfer events at this interval, 0 relays once")
+	flags.IntVar(&cfg.EFT.Outbox.Batch, "relay-batch", cfg.EFT.Outbox.Batch, "transfer events per relay")
+	flags.StringVar(&cfg.EFT.Outbox.Topic, "event-topic", cfg.EFT.Outbox.Topic, "Kafka topic for transfer events")
+
+	flags.StringVar(&cfg.EFT.Statement.Date, "settlement-date", cfg.EFT.Statement.Date, "statement settlement date, 20060102, default yesterday")
+
+	flags.StringVar(&cfg.EFT.Settlement.Date, "report-date", cfg.EFT.Settlement.Date, "settlement report business date, 20060102, default yesterday")
+	flags.StringVar(&cfg.EFT.Settlement.Destination, "report-destination", cfg.EFT.Settlement.Destination, "settlement report to s3 or sftp")
+
+	flags.StringVar(&cfg.EFT.Payout.Source, "payout-source", cfg.EFT.Payout.Source, "payout instructions from s3, sftp or db")
+	flags.StringVar(&cfg.EFT.Payout.File, "payout-file", cfg.EFT.Payout.File, "payout instruction file key or path")
+	flags.StringVar(&cfg.EFT.Payout.BatchID, "batch-id", cfg.EFT.Payout.BatchID, "payout batch ID, default the file's base name")
+	flags.IntVar(&cfg.EFT.Payout.Concurrency, "concurrency", cfg.EFT.Payout.Concurrency, "payout transfers in flight")
+	flags.Float64Var(&cfg.EFT.Payout.RatePerSecond, "rate", cfg.EFT.Payout.RatePerSecond, "payout transfers started per second")
+
+	flags.StringVar(&cfg.EFT.MockBank.Addr, "addr", cfg.EFT.MockBank.Addr, "mock bank listen address")
+	flags.StringVar(&cfg.EFT.MockBank.Script, "script", cfg.EFT.MockBank.Script, "mock bank scenario script (JSON)")
+
+	return flags
+}
+
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, job.ErrArchiveAuditFailed),
+		errors.Is(err, job.ErrArchiveVerifyFailed),
+		errors.Is(err, job.ErrReconcileMismatch),
+		errors.Is(err, job.ErrQualityThreshold),
+		errors.Is(err, eft.ErrStatementMismatch),
+		errors.Is(err, eft.ErrUnresolvedTransfers):
+		return exitCheckFailed
+	default:
+		return exitFailure
+	}
+}
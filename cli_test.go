@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/job"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{name: "ok", err: nil, code: exitOK},
+		{name: "config error", err: usageErrorf("invalid partition configuration: %v", errors.New("bad from")), code: exitUsage},
+		{name: "verify failed", err: fmt.Errorf("%w: checksum of x does not match manifest", job.ErrArchiveVerifyFailed), code: exitCheckFailed},
+		{name: "audit failed", err: job.ErrArchiveAuditFailed, code: exitCheckFailed},
+		{name: "reconcile mismatch", err: fmt.Errorf("%w: partition _y2024m04", job.ErrReconcileMismatch), code: exitCheckFailed},
+		{name: "quality threshold", err: job.ErrQualityThreshold, code: exitCheckFailed},
+		{name: "statement mismatch", err: eft.ErrStatementMismatch, code: exitCheckFailed},
+		{name: "unresolved transfers", err: eft.ErrUnresolvedTransfers, code: exitCheckFailed},
+		{name: "restore into filled table", err: fmt.Errorf("%w: his_pricing_y2024m04", job.ErrRestoreTableNotEmpty), code: exitFailure},
+		{name: "db down", err: errors.Wrap(errors.New("connection refused"), "server connect to db"), code: exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, exitCode(tt.err))
+		})
+	}
+}
+
+func TestRunCLIUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "unknown command", args: []string{"compact"}},
+		{name: "unknown flag", args: []string{"verify", "-bogus"}},
+		{name: "extra argument", args: []string{"verify", "_y2024m04"}},
+		{name: "bad partition", args: []string{"verify", "-from", "2024-13"}},
+		{name: "partition without end", args: []string{"restore", "-from", "2024-04"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, exitUsage, runCLI(tt.args))
+		})
+	}
+}
+
+func TestNewFlagSet(t *testing.T) {
+	cfg := &config.Config{Mode: commandRestore}
+	cfg.Restore.Table = "his_pricing%s"
+	flags := newFlagSet(cfg)
+	err := flags.Parse([]string{
+		"-bucket", "archive",
+		"-scheme", "weekly",
+		"-from", "2024-04-01",
+		"-count", "2",
+		"-table", "restored%s",
+		"-create",
+		"-source",
+		"-max-rejected-rows", "-1",
+		"-payout-source", "sftp",
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "archive", cfg.S3Config.BucketName)
+	assert.Equal(t, config.PartitionConfig{Scheme: "weekly", From: "2024-04-01", Count: 2}, cfg.Partition)
+	assert.Equal(t, config.RestoreConfig{Table: "restored%s", Create: true}, cfg.Restore)
+	assert.Equal(t, true, cfg.Verify.Source)
+	assert.Equal(t, -1, cfg.Quality.MaxRejectedRows)
+	assert.Equal(t, "sftp", cfg.EFT.Payout.Source)
+}
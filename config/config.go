@@ -20,6 +20,215 @@ type Config struct {
 	RedisConfig RedisConfig
 	S3Config    S3Config
 	Producer    Producer
+	Mode        string
+	Audit       AuditConfig
+	Partition   PartitionConfig
+	Quality     QualityConfig
+	Restore     RestoreConfig
+	Verify      VerifyConfig
+	EFT         EFTConfig
+}
+
+type EFTConfig struct {
+	MerchantID  string
+	OAuthURL    string
+	VerifyURL   string
+	TransferURL string
+	InquiryURL  string
+	BasicAuth   string
+	// ResponseCodes maps the bank's responseCode values onto eft error
+	// kinds, e.g. 2001 to INSUFFICIENT_FUNDS, as given in its interface spec.
+	ResponseCodes   map[string]string
+	Retry           RetryConfig
+	Limiter         LimiterConfig
+	Breaker         BreakerConfig
+	AuditLog        EFTAuditLogConfig
+	Signing         SigningConfig
+	Timeout         EFTTimeoutConfig
+	InquiryInterval time.Duration
+	MaxInquiry      int
+	// TokenSafetyMargin is taken off expires_in when caching the OAuth token.
+	TokenSafetyMargin time.Duration
+	TokenLockTTL      time.Duration
+	IdempotencyTTL    time.Duration
+	// AbandonAfter is how long a transfer may stay INITIATED or VERIFIED
+	// before it is failed as abandoned. It must outlast verify with retries.
+	AbandonAfter time.Duration
+	// NameMatchThreshold is the least eft.NameSimilarity accepted as the
+	// expected beneficiary, from 0 to 1.
+	NameMatchThreshold float64
+	Poller             InquiryPollerConfig
+	Outbox             OutboxConfig
+	Statement          StatementConfig
+	Settlement         SettlementReportConfig
+	MockBank           MockBankConfig
+	Payout             PayoutConfig
+	SFTP               SFTPConfig
+	HTTP               HTTP
+	Toggle             ToggleConfiguration
+}
+
+// MockBankConfig serves eft/mockbank for the mock-bank command; Script is an
+// optional path to a mockbank.Script JSON file.
+type MockBankConfig struct {
+	Addr   string
+	Script string
+}
+
+// StatementConfig locates the bank's daily statement file. Path and ReportKey
+// take the settlement date (20060102) as %s; an empty Date means yesterday.
+type StatementConfig struct {
+	Path      string
+	Date      string
+	Delimiter string
+	ReportKey string
+}
+
+// SettlementReportConfig drives the settlement-report command. CSVKey and
+// JSONKey take the business date (20060102) as %s; an empty Date means
+// yesterday. Destination is s3 or sftp.
+type SettlementReportConfig struct {
+	Date        string
+	Destination string
+	CSVKey      string
+	JSONKey     string
+}
+
+// PayoutConfig drives the payout command. Source is s3, sftp or db; File is
+// the instruction file key or path, and the batch ID defaults to its base
+// name. RatePerSecond caps transfers started per second across workers.
+type PayoutConfig struct {
+	Source        string
+	File          string
+	BatchID       string
+	Delimiter     string
+	Concurrency   int
+	RatePerSecond float64
+}
+
+type SFTPConfig struct {
+	Server     string
+	Username   string
+	Password   string
+	PrivateKey string
+	Timeout    time.Duration
+}
+
+// InquiryPollerConfig drives the poll-inquiry command. Transfers are picked up
+// MinAge after creation, retried BaseDelay*2^attempts apart (capped at
+// MaxDelay) and escalated once older than Cutoff. A zero Interval polls once.
+type InquiryPollerConfig struct {
+	MinAge       time.Duration
+	Cutoff       time.Duration
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Interval     time.Duration
+	Batch        int
+	PublishKafka bool
+	Topic        string
+}
+
+// OutboxConfig drives the relay-outbox command, which publishes up to Batch
+// transfer events to Topic per run. A zero Interval relays once. An event
+// that fails MaxAttempts times is parked; zero never parks.
+type OutboxConfig struct {
+	Interval    time.Duration
+	Batch       int
+	Topic       string
+	MaxAttempts int
+}
+
+// EFTTimeoutConfig bounds each bank call; retried calls get it per attempt.
+type EFTTimeoutConfig struct {
+	OAuth    time.Duration
+	Verify   time.Duration
+	Transfer time.Duration
+	Inquiry  time.Duration
+}
+
+// RetryConfig drives eft.RetryPolicy. The wait before retry n is
+// BaseDelay*Multiplier^(n-1), capped at MaxDelay and spread by ±Jitter;
+// Deadline bounds all attempts together.
+type RetryConfig struct {
+	MaxAttempts     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	Multiplier      float64
+	Jitter          float64
+	Deadline        time.Duration
+	RetryableStatus []int
+}
+
+// LimiterConfig caps calls to the bank. With Redis the limit is shared by
+// every instance through RedisConfig, else it holds per process.
+type LimiterConfig struct {
+	RatePerSecond float64
+	Burst         int
+	Redis         bool
+}
+
+// BreakerConfig drives eft.CircuitBreaker; a zero FailureThreshold never opens it.
+type BreakerConfig struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenMax      int
+}
+
+// EFTAuditLogConfig picks where the masked record of each bank call goes:
+// the append-only fund_transfer_audit_log table, a Kafka topic, or both.
+// Timeout bounds each write, as it holds up the bank call it records.
+type EFTAuditLogConfig struct {
+	StoreDB      bool
+	PublishKafka bool
+	Topic        string
+	Timeout      time.Duration
+}
+
+// SigningConfig turns on JWS signing of eft request bodies with
+// Secret.Private and verification of responses with BankPublicKey. Mode is
+// DETACHED, a JWS in Header beside the plain body, or COMPACT, the body
+// replaced by the JWS. Encrypt wraps bodies both ways in RSA-OAEP-256/A256GCM
+// JWE.
+type SigningConfig struct {
+	Enabled       bool
+	Mode          string
+	Header        string
+	Alg           string
+	KeyID         string
+	BankAlg       string
+	BankKeyID     string
+	BankPublicKey []byte
+	Encrypt       bool
+}
+
+type RestoreConfig struct {
+	Table  string
+	Create bool
+}
+
+type VerifyConfig struct {
+	Source bool
+}
+
+type QualityConfig struct {
+	Rules           []string
+	RequiredColumns []string
+	MaxRejectedRows int
+}
+
+type PartitionConfig struct {
+	Scheme   string
+	From     string
+	To       string
+	Count    int
+	Previous int
+}
+
+type AuditConfig struct {
+	ReportKey    string
+	PublishKafka bool
+	Topic        string
+	StoreDB      bool
 }
 
 type Producer struct {
@@ -31,9 +240,13 @@ type S3Config struct {
 	Key        string
 }
 
+// ToggleConfiguration routes eft calls to the in-process eft/mockbank when
+// IsTest is set. Script is a mockbank.Script file mapping transfers to
+// outcomes; without one Case "F" fails every call and anything else passes.
 type ToggleConfiguration struct {
 	IsTest bool
 	Case   string
+	Script string
 }
 
 type DestinationConfig struct {
@@ -99,6 +312,9 @@ type KafkaConfig struct {
 	Strategy string
 }
 
+// HTTP configures a client. CertFile, KeyFile and CAFile are PEM contents,
+// loaded from the common secret; PinnedSPKI and CertExpiryWarning are only
+// used by the EFT client.
 type HTTP struct {
 	TimeOut            time.Duration
 	MaxIdleConn        int
@@ -106,6 +322,10 @@ type HTTP struct {
 	MaxConnPerHost     int
 	CertFile           []byte
 	KeyFile            []byte
+	CAFile             []byte
+	PinnedSPKI         []string
+	CertExpiryWarning  time.Duration
+	CertCheckInterval  time.Duration
 }
 type AWSConfig struct {
 	RDSSecret    string
@@ -147,6 +367,111 @@ func InitConfig() (*Config, error) {
 	viper.SetDefault("S3Config.Key", "his_pricing/his_pricing%s.zip")
 	viper.SetDefault("S3Config.BucketName", "poc-sync-app")
 
+	viper.SetDefault("PARTITION.SCHEME", "monthly")
+	viper.SetDefault("PARTITION.FROM", os.Getenv("startPartition"))
+	viper.SetDefault("PARTITION.TO", os.Getenv("endPartition"))
+	viper.SetDefault("PARTITION.COUNT", os.Getenv("numOfMonth"))
+	viper.SetDefault("PARTITION.PREVIOUS", os.Getenv("previousPartitions"))
+
+	viper.SetDefault("QUALITY.RULES", []string{"required", "price_spread", "created_date_bounds", "duplicate_request_ref"})
+	viper.SetDefault("QUALITY.REQUIREDCOLUMNS", []string{"created_date", "request_ref", "buy_price", "sell_price"})
+	viper.SetDefault("QUALITY.MAXREJECTEDROWS", 0)
+
+	viper.SetDefault("RESTORE.TABLE", "his_pricing%s")
+	viper.SetDefault("RESTORE.CREATE", false)
+	viper.SetDefault("VERIFY.SOURCE", false)
+
+	viper.SetDefault("EFT.MERCHANTID", os.Getenv("eftMerchantID"))
+	viper.SetDefault("EFT.OAUTHURL", os.Getenv("eftOauthUrl"))
+	viper.SetDefault("EFT.VERIFYURL", os.Getenv("eftVerifyUrl"))
+	viper.SetDefault("EFT.TRANSFERURL", os.Getenv("eftTransferUrl"))
+	viper.SetDefault("EFT.INQUIRYURL", os.Getenv("eftInquiryUrl"))
+	viper.SetDefault("EFT.BASICAUTH", os.Getenv("eftBasicAuth"))
+	viper.SetDefault("EFT.RESPONSECODES", parseCodeMap(os.Getenv("eftResponseCodes")))
+	viper.SetDefault("EFT.RETRY.MAXATTEMPTS", 3)
+	viper.SetDefault("EFT.RETRY.BASEDELAY", "1s")
+	viper.SetDefault("EFT.RETRY.MAXDELAY", "10s")
+	viper.SetDefault("EFT.RETRY.MULTIPLIER", 2)
+	viper.SetDefault("EFT.RETRY.JITTER", 0.2)
+	viper.SetDefault("EFT.RETRY.DEADLINE", "30s")
+	viper.SetDefault("EFT.LIMITER.RATEPERSECOND", 20)
+	viper.SetDefault("EFT.LIMITER.BURST", 5)
+	viper.SetDefault("EFT.LIMITER.REDIS", false)
+	viper.SetDefault("EFT.BREAKER.FAILURETHRESHOLD", 5)
+	viper.SetDefault("EFT.BREAKER.OPENTIMEOUT", "30s")
+	viper.SetDefault("EFT.BREAKER.HALFOPENMAX", 1)
+	viper.SetDefault("EFT.AUDITLOG.STOREDB", true)
+	viper.SetDefault("EFT.AUDITLOG.PUBLISHKAFKA", false)
+	viper.SetDefault("EFT.AUDITLOG.TOPIC", os.Getenv("eftAuditLogTopic"))
+	viper.SetDefault("EFT.AUDITLOG.TIMEOUT", "2s")
+	viper.SetDefault("EFT.SIGNING.ENABLED", false)
+	viper.SetDefault("EFT.SIGNING.MODE", "DETACHED")
+	viper.SetDefault("EFT.SIGNING.HEADER", "X-JWS-Signature")
+	viper.SetDefault("EFT.SIGNING.ALG", "RS256")
+	viper.SetDefault("EFT.SIGNING.KEYID", os.Getenv("eftSigningKeyId"))
+	viper.SetDefault("EFT.SIGNING.BANKALG", "RS256")
+	viper.SetDefault("EFT.SIGNING.BANKKEYID", os.Getenv("eftBankKeyId"))
+	viper.SetDefault("EFT.SIGNING.ENCRYPT", false)
+	viper.SetDefault("EFT.TIMEOUT.OAUTH", "10s")
+	viper.SetDefault("EFT.TIMEOUT.VERIFY", "15s")
+	viper.SetDefault("EFT.TIMEOUT.TRANSFER", "30s")
+	viper.SetDefault("EFT.TIMEOUT.INQUIRY", "15s")
+	viper.SetDefault("EFT.INQUIRYINTERVAL", "5s")
+	viper.SetDefault("EFT.MAXINQUIRY", 6)
+	viper.SetDefault("EFT.TOKENSAFETYMARGIN", "60s")
+	viper.SetDefault("EFT.TOKENLOCKTTL", "10s")
+	viper.SetDefault("EFT.IDEMPOTENCYTTL", "72h")
+	viper.SetDefault("EFT.ABANDONAFTER", "10m")
+	viper.SetDefault("EFT.NAMEMATCHTHRESHOLD", 0.85)
+	viper.SetDefault("EFT.POLLER.MINAGE", "5m")
+	viper.SetDefault("EFT.POLLER.CUTOFF", "24h")
+	viper.SetDefault("EFT.POLLER.BASEDELAY", "1m")
+	viper.SetDefault("EFT.POLLER.MAXDELAY", "1h")
+	viper.SetDefault("EFT.POLLER.INTERVAL", "0s")
+	viper.SetDefault("EFT.POLLER.BATCH", 100)
+	viper.SetDefault("EFT.POLLER.TOPIC", os.Getenv("eftExceptionTopic"))
+	viper.SetDefault("EFT.OUTBOX.INTERVAL", "0s")
+	viper.SetDefault("EFT.OUTBOX.BATCH", 500)
+	viper.SetDefault("EFT.OUTBOX.TOPIC", os.Getenv("eftTransferEventTopic"))
+	viper.SetDefault("EFT.OUTBOX.MAXATTEMPTS", 10)
+	viper.SetDefault("EFT.STATEMENT.PATH", os.Getenv("eftStatementPath"))
+	viper.SetDefault("EFT.STATEMENT.DATE", os.Getenv("eftStatementDate"))
+	viper.SetDefault("EFT.STATEMENT.DELIMITER", ",")
+	viper.SetDefault("EFT.STATEMENT.REPORTKEY", "fund_transfer/statement/report_%s.json")
+	viper.SetDefault("EFT.SFTP.SERVER", os.Getenv("eftSftpServer"))
+	viper.SetDefault("EFT.SFTP.USERNAME", os.Getenv("eftSftpUsername"))
+	viper.SetDefault("EFT.SFTP.PASSWORD", os.Getenv("eftSftpPassword"))
+	viper.SetDefault("EFT.SFTP.PRIVATEKEY", os.Getenv("eftSftpPrivateKey"))
+	viper.SetDefault("EFT.SFTP.TIMEOUT", "30s")
+	viper.SetDefault("EFT.MOCKBANK.ADDR", ":8089")
+	viper.SetDefault("EFT.MOCKBANK.SCRIPT", os.Getenv("eftMockBankScript"))
+	viper.SetDefault("EFT.SETTLEMENT.DATE", os.Getenv("eftSettlementDate"))
+	viper.SetDefault("EFT.SETTLEMENT.DESTINATION", "s3")
+	viper.SetDefault("EFT.SETTLEMENT.CSVKEY", "fund_transfer/settlement/summary_%s.csv")
+	viper.SetDefault("EFT.SETTLEMENT.JSONKEY", "fund_transfer/settlement/summary_%s.json")
+	viper.SetDefault("EFT.PAYOUT.SOURCE", "s3")
+	viper.SetDefault("EFT.PAYOUT.FILE", os.Getenv("eftPayoutFile"))
+	viper.SetDefault("EFT.PAYOUT.BATCHID", os.Getenv("eftPayoutBatchID"))
+	viper.SetDefault("EFT.PAYOUT.DELIMITER", ",")
+	viper.SetDefault("EFT.PAYOUT.CONCURRENCY", 4)
+	viper.SetDefault("EFT.PAYOUT.RATEPERSECOND", 5)
+	viper.SetDefault("EFT.HTTP.TIMEOUT", "30s")
+	viper.SetDefault("EFT.HTTP.MAXIDLECONN", 10)
+	viper.SetDefault("EFT.HTTP.MAXIDLECONNPERHOST", 10)
+	viper.SetDefault("EFT.HTTP.MAXCONNPERHOST", 10)
+	viper.SetDefault("EFT.HTTP.PINNEDSPKI", strings.FieldsFunc(os.Getenv("eftPinnedSpki"), func(r rune) bool { return r == ',' }))
+	viper.SetDefault("EFT.HTTP.CERTEXPIRYWARNING", "720h")
+	viper.SetDefault("EFT.HTTP.CERTCHECKINTERVAL", "1h")
+	viper.SetDefault("EFT.TOGGLE.ISTEST", os.Getenv("eftIsTest"))
+	viper.SetDefault("EFT.TOGGLE.CASE", os.Getenv("eftTestCase"))
+	viper.SetDefault("EFT.TOGGLE.SCRIPT", os.Getenv("eftTestScript"))
+
+	viper.SetDefault("MODE", os.Getenv("mode"))
+	viper.SetDefault("AUDIT.REPORTKEY", "his_pricing/audit/report%s.json")
+	viper.SetDefault("AUDIT.PUBLISHKAFKA", os.Getenv("auditPublishKafka"))
+	viper.SetDefault("AUDIT.TOPIC", os.Getenv("auditTopic"))
+	viper.SetDefault("AUDIT.STOREDB", os.Getenv("auditStoreDB"))
+
 	//viper.SetDefault("REDISCONFIG.MODE", os.Getenv("redisMode"))
 	//viper.SetDefault("REDISCONFIG.HOST", os.Getenv("redisHost"))
 	//viper.SetDefault("REDISCONFIG.Cluster.Addr", os.Getenv("redisHost"))
@@ -164,6 +489,20 @@ func InitConfig() (*Config, error) {
 	return &c, nil
 }
 
+// parseCodeMap reads "code=value" pairs separated by commas, as in
+// "1001=INVALID_ACCOUNT,2001=INSUFFICIENT_FUNDS".
+func parseCodeMap(value string) map[string]string {
+	codes := map[string]string{}
+	for _, pair := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' }) {
+		code, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		codes[strings.TrimSpace(code)] = strings.TrimSpace(name)
+	}
+	return codes
+}
+
 func InitTimeZone() {
 	ict, err := time.LoadLocation("Asia/Bangkok")
 	if err != nil {
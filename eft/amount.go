@@ -0,0 +1,116 @@
+package eft
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+const amountScale = 2
+
+var ErrAmountMismatch = errors.New("amount mismatch")
+
+// Amount is a baht amount. It marshals as a string with two decimals, the
+// way the gateway takes it, and unmarshals from either a string or a number.
+type Amount struct {
+	decimal.Decimal
+}
+
+func NewAmount(value string) (Amount, error) {
+	d, err := decimal.NewFromString(strings.ReplaceAll(strings.TrimSpace(value), ",", ""))
+	if err != nil {
+		return Amount{}, fmt.Errorf("invalid amount %q", value)
+	}
+	return Amount{Decimal: d}, nil
+}
+
+func MustAmount(value string) Amount {
+	amount, err := NewAmount(value)
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
+
+func (a Amount) String() string {
+	return a.StringFixed(amountScale)
+}
+
+func (a Amount) Equal(other Amount) bool {
+	return a.Decimal.Equal(other.Decimal)
+}
+
+// Validate accepts positive amounts with at most two decimals.
+func (a Amount) Validate() error {
+	if !a.IsPositive() {
+		return fmt.Errorf("amount %s must be positive", a)
+	}
+	if !a.Decimal.Equal(a.Round(amountScale)) {
+		return fmt.Errorf("amount %s has more than %d decimals", a.Decimal, amountScale)
+	}
+	return nil
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*a = Amount{}
+		return nil
+	}
+	value := string(bytes.Trim(data, `"`))
+	if value == "" {
+		*a = Amount{}
+		return nil
+	}
+	amount, err := NewAmount(value)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Value stores the amount as numeric text.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan reads numeric, text or NULL (zero) columns.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = Amount{}
+		return nil
+	case string:
+		amount, err := NewAmount(v)
+		*a = amount
+		return err
+	case []byte:
+		amount, err := NewAmount(string(v))
+		*a = amount
+		return err
+	case float64:
+		*a = Amount{Decimal: decimal.NewFromFloat(v)}
+		return nil
+	case int64:
+		*a = Amount{Decimal: decimal.NewFromInt(v)}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Amount", src)
+}
+
+// checkAmount compares the amount the bank echoed back with the one sent.
+func checkAmount(want, got Amount) error {
+	if !want.Equal(got) {
+		return fmt.Errorf("%w: sent %s, bank returned %s", ErrAmountMismatch, want, got)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package eft
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAmountJSON(t *testing.T) {
+	body, err := json.Marshal(VerifyDataFundTransferRequest{Amount: MustAmount("1500.5")})
+	assert.Equal(t, nil, err)
+	assert.Contains(t, string(body), `"amount":"1500.50"`)
+
+	var response VerifyDataFundTransferResponse
+	assert.Equal(t, nil, json.Unmarshal([]byte(`{"amount":1500.50}`), &response))
+	assert.Equal(t, nil, checkAmount(MustAmount("1500.5"), response.Amount))
+	assert.Equal(t, nil, json.Unmarshal([]byte(`{"amount":"0.10"}`), &response))
+	assert.ErrorIs(t, checkAmount(MustAmount("0.1000001"), response.Amount), ErrAmountMismatch)
+
+	assert.Equal(t, nil, MustAmount("0.01").Validate())
+	assert.Error(t, MustAmount("0").Validate())
+	assert.Error(t, MustAmount("1.005").Validate())
+}
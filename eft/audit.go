@@ -0,0 +1,240 @@
+package eft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/kafka"
+	"go.uber.org/zap"
+)
+
+// maskedFields keep only their last four characters in audit records and
+// error messages; redactedFields are dropped entirely. Keys match
+// case-insensitively at any depth.
+var (
+	maskedFields   = map[string]bool{"fromaccountno": true, "sendertaxid": true, "proxyvalue": true, "customermobileno": true}
+	redactedFields = map[string]bool{"access_token": true}
+)
+
+const maxErrorBody = 512
+
+// MaskValue replaces all but the last four characters with X, or all of
+// them when the value is four characters or shorter.
+func MaskValue(value string) string {
+	runes := []rune(value)
+	keep := 4
+	if len(runes) <= keep {
+		keep = 0
+	}
+	for i := 0; i < len(runes)-keep; i++ {
+		runes[i] = 'X'
+	}
+	return string(runes)
+}
+
+// MaskPayload returns body with the sensitive fields masked, or nil when
+// body is not JSON.
+func MaskPayload(body []byte) json.RawMessage {
+	var payload interface{}
+	if len(body) == 0 || json.Unmarshal(body, &payload) != nil {
+		return nil
+	}
+	masked, err := json.Marshal(maskValue(payload))
+	if err != nil {
+		return nil
+	}
+	return masked
+}
+
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			name := strings.ToLower(key)
+			switch {
+			case redactedFields[name]:
+				v[key] = "REDACTED"
+			case maskedFields[name]:
+				if s, ok := field.(string); ok {
+					v[key] = MaskValue(s)
+				}
+			default:
+				v[key] = maskValue(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = maskValue(v[i])
+		}
+	}
+	return value
+}
+
+// maskBody is a bank response body safe for error messages and logs: masked
+// when it is JSON, cut to maxErrorBody otherwise.
+func maskBody(body []byte) string {
+	if masked := MaskPayload(body); masked != nil {
+		return string(masked)
+	}
+	if len(body) > maxErrorBody {
+		return string(body[:maxErrorBody]) + "..."
+	}
+	return string(body)
+}
+
+// AuditRecord is one outbound bank call. Request and Response are masked;
+// headers are never recorded.
+type AuditRecord struct {
+	Endpoint        string          `json:"endpoint"`
+	Method          string          `json:"method"`
+	MerchantTransID string          `json:"merchantTransID,omitempty"`
+	RsTransID       string          `json:"rsTransID,omitempty"`
+	StatusCode      int             `json:"statusCode,omitempty"`
+	ResponseCode    string          `json:"responseCode,omitempty"`
+	LatencyMs       int64           `json:"latencyMs"`
+	Error           string          `json:"error,omitempty"`
+	Request         json.RawMessage `json:"request,omitempty"`
+	Response        json.RawMessage `json:"response,omitempty"`
+	CreatedAt       time.Time       `json:"createdAt"`
+}
+
+type WriteAuditLogFunc func(ctx context.Context, logger *zap.Logger, record AuditRecord) error
+
+func InsertAuditLog(db *pgxpool.Pool) WriteAuditLogFunc {
+	return func(ctx context.Context, logger *zap.Logger, record AuditRecord) error {
+		sql := `insert into fund_transfer_audit_log (endpoint, method, merchant_trans_id, rs_trans_id, status_code, response_code,
+				latency_ms, error, request, response, created_at)
+				values ($1, $2, nullif($3, ''), nullif($4, ''), nullif($5, 0), nullif($6, ''), $7, nullif($8, ''), $9, $10, $11)`
+		_, err := db.Exec(ctx, sql,
+			record.Endpoint,
+			record.Method,
+			record.MerchantTransID,
+			record.RsTransID,
+			record.StatusCode,
+			record.ResponseCode,
+			record.LatencyMs,
+			record.Error,
+			nullableJSON(record.Request),
+			nullableJSON(record.Response),
+			record.CreatedAt,
+		)
+		return err
+	}
+}
+
+func nullableJSON(raw json.RawMessage) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
+
+// PublishAuditLogToKafka keys records by merchantTransID, so one transfer's
+// calls stay in order. The sender must not log the payload.
+func PublishAuditLogToKafka(send kafka.SendMessageSyncWithKeyFunc, topic string) WriteAuditLogFunc {
+	return func(ctx context.Context, logger *zap.Logger, record AuditRecord) error {
+		return send(logger, record.MerchantTransID, record, topic)
+	}
+}
+
+type auditTransport struct {
+	next    http.RoundTripper
+	logger  *zap.Logger
+	timeout time.Duration
+	writes  []WriteAuditLogFunc
+}
+
+// AuditTransport records every call made through next with each
+// WriteAuditLogFunc. A failed write is logged and does not fail the call,
+// since the bank may already have acted on it. Each write is given up on
+// after timeout, so a slow sink cannot stall payments; zero means no limit.
+func AuditTransport(next http.RoundTripper, logger *zap.Logger, timeout time.Duration, WriteAuditLogFuncs ...WriteAuditLogFunc) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &auditTransport{next: next, logger: logger, timeout: timeout, writes: WriteAuditLogFuncs}
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	record := AuditRecord{
+		Endpoint:  req.URL.Path,
+		Method:    req.Method,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Request:   MaskPayload(reqBody),
+		CreatedAt: start,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.StatusCode = res.StatusCode
+		resBody, readErr := io.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(resBody))
+		if readErr != nil {
+			record.Error = readErr.Error()
+		}
+		record.Response = MaskPayload(resBody)
+	}
+	record.MerchantTransID, record.RsTransID, _ = auditIDs(reqBody)
+	merchantTransID, rsTransID, responseCode := auditIDs(record.Response)
+	record.ResponseCode = responseCode
+	if record.MerchantTransID == "" {
+		record.MerchantTransID = merchantTransID
+	}
+	if record.RsTransID == "" {
+		record.RsTransID = rsTransID
+	}
+
+	for _, write := range t.writes {
+		if writeErr := t.write(write, record); writeErr != nil {
+			t.logger.Error("Error WriteAuditLogFunc", zap.String("endpoint", record.Endpoint), zap.Error(writeErr))
+		}
+	}
+	return res, err
+}
+
+// write runs one write apart from the caller's context, which may already be
+// done, and stops waiting for it after t.timeout even when it ignores ctx.
+func (t *auditTransport) write(write WriteAuditLogFunc, record AuditRecord) error {
+	ctx, cancel := withTimeout(context.Background(), t.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- write(ctx, t.logger, record)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func auditIDs(body []byte) (merchantTransID, rsTransID, responseCode string) {
+	var ids struct {
+		MerchantTransID string `json:"merchantTransID"`
+		RsTransID       string `json:"rsTransID"`
+		ResponseCode    string `json:"responseCode"`
+	}
+	if len(body) > 0 && json.Unmarshal(body, &ids) == nil {
+		return ids.MerchantTransID, ids.RsTransID, ids.ResponseCode
+	}
+	return "", "", ""
+}
@@ -0,0 +1,95 @@
+package eft
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMaskPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "verify request",
+			body: `{"merchantTransID":"T1","proxyValue":"1234567890","fromAccountNo":"0987654321","senderTaxID":"1103700012345","amount":"10.00"}`,
+			want: `{"amount":"10.00","fromAccountNo":"XXXXXX4321","merchantTransID":"T1","proxyValue":"XXXXXX7890","senderTaxID":"XXXXXXXXX2345"}`,
+		},
+		{name: "token", body: `{"access_token":"secret","status":"approved"}`, want: `{"access_token":"REDACTED","status":"approved"}`},
+		{name: "short value", body: `{"ProxyValue":"123"}`, want: `{"ProxyValue":"XXX"}`},
+		{name: "not json", body: `grant_type=client_credentials`, want: ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(MaskPayload([]byte(tt.body))))
+		})
+	}
+}
+
+func TestAuditTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"merchantTransID":"T1","rsTransID":"RS1","responseCode":"0000","proxyValue":"1234567890"}`)
+	}))
+	defer server.Close()
+
+	var records []AuditRecord
+	write := func(ctx context.Context, logger *zap.Logger, record AuditRecord) error {
+		records = append(records, record)
+		return nil
+	}
+	client := &http.Client{Transport: AuditTransport(nil, zap.NewNop(), time.Second, write)}
+
+	res, err := client.Post(server.URL+"/fundtransfer/verify", "application/json", bytes.NewBufferString(`{"merchantTransID":"T1","fromAccountNo":"0987654321"}`))
+	assert.Equal(t, nil, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	// The caller still gets the unmasked response.
+	assert.Contains(t, string(body), `"proxyValue":"1234567890"`)
+	assert.Equal(t, 1, len(records))
+	record := records[0]
+	assert.Equal(t, "/fundtransfer/verify", record.Endpoint)
+	assert.Equal(t, "T1", record.MerchantTransID)
+	assert.Equal(t, "RS1", record.RsTransID)
+	assert.Equal(t, http.StatusOK, record.StatusCode)
+	assert.Equal(t, "0000", record.ResponseCode)
+	assert.Equal(t, `{"fromAccountNo":"XXXXXX4321","merchantTransID":"T1"}`, string(record.Request))
+	assert.Contains(t, string(record.Response), `"proxyValue":"XXXXXX7890"`)
+}
+
+func TestAuditTransportSlowWrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"responseCode":"0000"}`)
+	}))
+	defer server.Close()
+
+	// A sink that ignores ctx, like a sync Kafka send, must not hold the call.
+	release := make(chan struct{})
+	defer close(release)
+	hung := func(ctx context.Context, logger *zap.Logger, record AuditRecord) error {
+		<-release
+		return nil
+	}
+	var records []AuditRecord
+	write := func(ctx context.Context, logger *zap.Logger, record AuditRecord) error {
+		records = append(records, record)
+		return nil
+	}
+	client := &http.Client{Transport: AuditTransport(nil, zap.NewNop(), 20*time.Millisecond, hung, write)}
+
+	start := time.Now()
+	res, err := client.Post(server.URL+"/fundtransfer/verify", "application/json", bytes.NewBufferString(`{"merchantTransID":"T1"}`))
+	assert.Equal(t, nil, err)
+	res.Body.Close()
+	assert.Equal(t, true, time.Since(start) < time.Second)
+	assert.Equal(t, 1, len(records))
+}
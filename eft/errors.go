@@ -0,0 +1,145 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type ErrorKind string
+
+const (
+	KindBusinessReject    ErrorKind = "BUSINESS_REJECT"
+	KindInvalidAccount    ErrorKind = "INVALID_ACCOUNT"
+	KindInsufficientFunds ErrorKind = "INSUFFICIENT_FUNDS"
+	KindDuplicate         ErrorKind = "DUPLICATE"
+	KindSystemError       ErrorKind = "SYSTEM_ERROR"
+	KindUnknown           ErrorKind = "UNKNOWN"
+)
+
+// kindFlags says per kind whether the same request may be sent again
+// (Retryable) and whether the transfer outcome is settled (Final). Anything
+// neither retryable nor final has to be resolved by inquiry.
+var kindFlags = map[ErrorKind]struct{ Retryable, Final bool }{
+	KindBusinessReject:    {Retryable: false, Final: true},
+	KindInvalidAccount:    {Retryable: false, Final: true},
+	KindInsufficientFunds: {Retryable: false, Final: true},
+	KindDuplicate:         {Retryable: false, Final: false},
+	KindSystemError:       {Retryable: true, Final: false},
+	KindUnknown:           {Retryable: false, Final: false},
+}
+
+// ResponseCodes maps the gateway's responseCode table onto error kinds. It
+// is filled at startup by SetResponseCodes from the bank's interface spec, as
+// configured in EFT.RESPONSECODES. Codes not listed are unknown, so the
+// transfer is resolved by inquiry rather than failed on a guess.
+var ResponseCodes = map[string]ErrorKind{
+	OtherExceptionFundTransfer: KindUnknown,
+}
+
+// SetResponseCodes replaces ResponseCodes with codes, each a responseCode and
+// the name of its kind such as INSUFFICIENT_FUNDS. The catch-all exception
+// code stays unknown.
+func SetResponseCodes(codes map[string]string) error {
+	table := map[string]ErrorKind{OtherExceptionFundTransfer: KindUnknown}
+	for code, name := range codes {
+		code = strings.TrimSpace(code)
+		kind := ErrorKind(strings.ToUpper(strings.TrimSpace(name)))
+		if _, ok := kindFlags[kind]; !ok {
+			return fmt.Errorf("response code %s: unknown error kind %q", code, name)
+		}
+		if code == SuccessFundTransfer || code == OtherExceptionFundTransfer {
+			return fmt.Errorf("response code %s cannot be remapped", code)
+		}
+		table[code] = kind
+	}
+	ResponseCodes = table
+	return nil
+}
+
+// GatewayError is a failed fund transfer gateway call, either a non-success
+// responseCode or a non-2xx answer. Branch on it with errors.As.
+type GatewayError struct {
+	Kind       ErrorKind
+	Code       string
+	Message    string
+	StatusCode int
+	Retryable  bool
+	Final      bool
+	Err        error
+}
+
+func (e *GatewayError) Error() string {
+	msg := fmt.Sprintf("eft gateway %s", e.Kind)
+	if e.Code != "" {
+		msg += fmt.Sprintf(" code %s", e.Code)
+	}
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" status %d", e.StatusCode)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *GatewayError) Unwrap() error { return e.Err }
+
+func newGatewayError(kind ErrorKind, code, message string, err error) *GatewayError {
+	flags := kindFlags[kind]
+	return &GatewayError{Kind: kind, Code: code, Message: message, Retryable: flags.Retryable, Final: flags.Final, Err: err}
+}
+
+// ResponseError classifies a gateway responseCode; it is nil for success.
+func ResponseError(code, message string) error {
+	if code == SuccessFundTransfer {
+		return nil
+	}
+	kind, ok := ResponseCodes[code]
+	if !ok {
+		kind = KindUnknown
+	}
+	return newGatewayError(kind, code, message, nil)
+}
+
+// StatusError classifies a non-2xx answer. 5xx are system errors; anything
+// else, a 4xx included, says nothing certain about the transfer, so the
+// outcome is left unknown.
+func StatusError(url string, statusCode int, body []byte) error {
+	kind := KindUnknown
+	if statusCode >= 500 && statusCode != http.StatusGatewayTimeout {
+		kind = KindSystemError
+	}
+	gwErr := newGatewayError(kind, "", "", &HTTPStatusError{URL: url, StatusCode: statusCode, Body: maskBody(body)})
+	gwErr.StatusCode = statusCode
+	return gwErr
+}
+
+// TransportError wraps a failed round trip. The request may or may not have
+// reached the bank, so the outcome is unknown.
+func TransportError(err error) error {
+	var netErr net.Error
+	message := "no response"
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		message = "timeout"
+	}
+	return newGatewayError(KindUnknown, "", message, err)
+}
+
+func (r *VerifyDataFundTransferResponse) Err() error {
+	return ResponseError(r.ResponseCode, r.ResponseMsg)
+}
+
+func (r *FundTransferResponse) Err() error {
+	return ResponseError(r.ResponseCode, r.ResponseMsg)
+}
+
+func (r *InquiryStatusResponse) Err() error {
+	return ResponseError(r.ResponseCode, r.ResponseMsg)
+}
@@ -0,0 +1,91 @@
+package eft
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseError(t *testing.T) {
+	defer func(codes map[string]ErrorKind) { ResponseCodes = codes }(ResponseCodes)
+	assert.Equal(t, nil, SetResponseCodes(map[string]string{
+		"1000": "business_reject",
+		"1001": "INVALID_ACCOUNT",
+		"2001": "INSUFFICIENT_FUNDS",
+		"3001": "DUPLICATE",
+		"5000": "SYSTEM_ERROR",
+		"5001": "UNKNOWN",
+	}))
+
+	tests := []struct {
+		code      string
+		kind      ErrorKind
+		retryable bool
+		final     bool
+	}{
+		{code: "1000", kind: KindBusinessReject, final: true},
+		{code: "1001", kind: KindInvalidAccount, final: true},
+		{code: "2001", kind: KindInsufficientFunds, final: true},
+		{code: "3001", kind: KindDuplicate},
+		{code: "5000", kind: KindSystemError, retryable: true},
+		{code: "5001", kind: KindUnknown},
+		{code: OtherExceptionFundTransfer, kind: KindUnknown},
+		{code: "1002", kind: KindUnknown},
+		{code: "", kind: KindUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			var gwErr *GatewayError
+			assert.Equal(t, true, errors.As(ResponseError(tt.code, "msg"), &gwErr))
+			assert.Equal(t, tt.kind, gwErr.Kind)
+			assert.Equal(t, tt.code, gwErr.Code)
+			assert.Equal(t, tt.retryable, gwErr.Retryable)
+			assert.Equal(t, tt.final, gwErr.Final)
+		})
+	}
+	assert.Equal(t, nil, ResponseError(SuccessFundTransfer, ""))
+}
+
+func TestSetResponseCodes(t *testing.T) {
+	defer func(codes map[string]ErrorKind) { ResponseCodes = codes }(ResponseCodes)
+
+	assert.NotEqual(t, nil, SetResponseCodes(map[string]string{"1001": "CLOSED"}))
+	assert.NotEqual(t, nil, SetResponseCodes(map[string]string{SuccessFundTransfer: "BUSINESS_REJECT"}))
+	assert.NotEqual(t, nil, SetResponseCodes(map[string]string{OtherExceptionFundTransfer: "BUSINESS_REJECT"}))
+
+	assert.Equal(t, nil, SetResponseCodes(nil))
+	assert.Equal(t, map[string]ErrorKind{OtherExceptionFundTransfer: KindUnknown}, ResponseCodes)
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status    int
+		kind      ErrorKind
+		retryable bool
+	}{
+		{status: http.StatusBadRequest, kind: KindUnknown},
+		{status: http.StatusNotFound, kind: KindUnknown},
+		{status: http.StatusConflict, kind: KindUnknown},
+		{status: http.StatusRequestTimeout, kind: KindUnknown},
+		{status: http.StatusInternalServerError, kind: KindSystemError, retryable: true},
+		{status: http.StatusServiceUnavailable, kind: KindSystemError, retryable: true},
+		{status: http.StatusGatewayTimeout, kind: KindUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := StatusError("/fundtransfer/confirm", tt.status, []byte(`{"error":"x"}`))
+			var gwErr *GatewayError
+			assert.Equal(t, true, errors.As(err, &gwErr))
+			assert.Equal(t, tt.kind, gwErr.Kind)
+			assert.Equal(t, tt.status, gwErr.StatusCode)
+			assert.Equal(t, tt.retryable, gwErr.Retryable)
+			assert.Equal(t, false, gwErr.Final)
+
+			var statusErr *HTTPStatusError
+			assert.Equal(t, true, errors.As(err, &statusErr))
+			assert.Equal(t, tt.status, statusErr.StatusCode)
+		})
+	}
+}
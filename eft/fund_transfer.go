@@ -2,12 +2,10 @@ package eft
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/google/uuid"
-	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
-	"os"
 
 	"go.uber.org/zap"
 	"io"
@@ -15,7 +13,11 @@ import (
 	"time"
 )
 
-var exceptionInquiryStatus = []string{"Fail", "In Process"}
+var exceptionInquiryStatus = []string{TxnStatusFail, TxnStatusInProcess}
+
+// ErrUnauthorized means the bank rejected the access token; callers should
+// invalidate it and retry with a fresh one.
+var ErrUnauthorized = errors.New("access token rejected")
 
 const (
 	SuccessFundTransfer        = "0000"
@@ -48,28 +50,28 @@ type VerifyDataFundTransferRequest struct {
 	SenderName      string `json:"senderName"`
 	SenderTaxID     string `json:"senderTaxID"`
 	ToBankCode      string `json:"toBankCode"`
-	Amount          string `json:"amount"`
+	Amount          Amount `json:"amount"`
 	TypeOfSender    string `json:"typeOfSender"`
 }
 
 type VerifyDataFundTransferResponse struct {
-	MerchantID       string  `json:"merchantID"`
-	MerchantTransID  string  `json:"merchantTransID"`
-	RsTransID        string  `json:"rsTransID"`
-	ResponseDateTime string  `json:"responseDateTime"`
-	ResponseCode     string  `json:"responseCode"`
-	ResponseMsg      string  `json:"responseMsg"`
-	ProxyType        string  `json:"proxyType"`
-	ProxyValue       string  `json:"proxyValue"`
-	ToBankCode       string  `json:"toBankCode"`
-	ToAccNameTH      string  `json:"toAccNameTH"`
-	ToAccNameEN      string  `json:"toAccNameEN"`
-	TransType        string  `json:"transType"`
-	FromAccountNo    string  `json:"fromAccountNo"`
-	SenderName       string  `json:"senderName"`
-	SenderTaxID      string  `json:"senderTaxID"`
-	TypeOfSender     string  `json:"typeOfSender"`
-	Amount           float64 `json:"amount"`
+	MerchantID       string `json:"merchantID"`
+	MerchantTransID  string `json:"merchantTransID"`
+	RsTransID        string `json:"rsTransID"`
+	ResponseDateTime string `json:"responseDateTime"`
+	ResponseCode     string `json:"responseCode"`
+	ResponseMsg      string `json:"responseMsg"`
+	ProxyType        string `json:"proxyType"`
+	ProxyValue       string `json:"proxyValue"`
+	ToBankCode       string `json:"toBankCode"`
+	ToAccNameTH      string `json:"toAccNameTH"`
+	ToAccNameEN      string `json:"toAccNameEN"`
+	TransType        string `json:"transType"`
+	FromAccountNo    string `json:"fromAccountNo"`
+	SenderName       string `json:"senderName"`
+	SenderTaxID      string `json:"senderTaxID"`
+	TypeOfSender     string `json:"typeOfSender"`
+	Amount           Amount `json:"amount"`
 }
 
 type FundTransferRequest struct {
@@ -109,27 +111,10 @@ type InquiryStatusResponse struct {
 	FailMsg          string `json:"failMsg"`
 }
 
-type HTTPFundTransferFunc func(logger *zap.Logger, req FundTransferRequest, accessToken string) (*FundTransferResponse, error)
-
-func HTTPFundTransfer(client *http.Client, url string, toggle config.ToggleConfiguration) HTTPFundTransferFunc {
-	return func(logger *zap.Logger, req FundTransferRequest, accessToken string) (*FundTransferResponse, error) {
-		if toggle.IsTest {
-			switch toggle.Case {
-			case "P":
-				return &FundTransferResponse{
-					MerchantID:       req.MerchantID,
-					MerchantTransID:  req.MerchantTransID,
-					RsTransID:        uuid.NewString(),
-					ResponseDateTime: time.Now().Format(time.RFC3339),
-					ResponseCode:     "0000",
-					ResponseMsg:      "Success",
-					SettlementDate:   time.Now().Format("20060102"),
-				}, nil
-			case "F":
-				return nil, os.ErrNotExist
-			}
-		}
+type HTTPFundTransferFunc func(ctx context.Context, logger *zap.Logger, req FundTransferRequest, accessToken string) (*FundTransferResponse, error)
 
+func HTTPFundTransfer(client *http.Client, url string, timeout time.Duration) HTTPFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, req FundTransferRequest, accessToken string) (*FundTransferResponse, error) {
 		var (
 			httpRes  *http.Response
 			err      error
@@ -141,8 +126,11 @@ func HTTPFundTransfer(client *http.Client, url string, toggle config.ToggleConfi
 			return nil, err
 		}
 
+		ctx, cancel := withTimeout(ctx, timeout)
+		defer cancel()
+
 		bearer := fmt.Sprintf("Bearer %s", accessToken)
-		httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(requestBodyJSON))
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(requestBodyJSON))
 		if err != nil {
 			return nil, fmt.Errorf("unable to New http request: %v", err)
 		}
@@ -153,259 +141,205 @@ func HTTPFundTransfer(client *http.Client, url string, toggle config.ToggleConfi
 		httpRes, err = client.Do(httpReq)
 		if err != nil {
 			logger.Error("Error on call http request", zap.Error(err))
+			return nil, TransportError(err)
+		}
+		defer httpRes.Body.Close()
+
+		if httpRes.StatusCode == http.StatusUnauthorized {
+			return nil, fmt.Errorf("%w: %s", ErrUnauthorized, url)
+		}
+
+		body, err := io.ReadAll(httpRes.Body)
+		if err != nil {
+			logger.Error("Error on read response", zap.Error(err))
+			return nil, TransportError(err)
+		}
+		if httpRes.StatusCode != http.StatusOK {
+			return nil, StatusError(url, httpRes.StatusCode, body)
+		}
+
+		err = json.Unmarshal(body, &response)
+		return response, err
+	}
+}
+
+type HTTPVerifyDataFundTransferFunc func(ctx context.Context, logger *zap.Logger, req VerifyDataFundTransferRequest, accessToken string) (*VerifyDataFundTransferResponse, error)
+
+// HTTPVerifyDataFundTransfer looks up the payee. Verify moves no money, so
+// transport failures and retryable statuses are retried under policy.
+func HTTPVerifyDataFundTransfer(client *http.Client, url string, timeout time.Duration, policy RetryPolicy) HTTPVerifyDataFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, req VerifyDataFundTransferRequest, accessToken string) (*VerifyDataFundTransferResponse, error) {
+		requestBodyJSON, err := json.Marshal(&req)
+		if err != nil {
 			return nil, err
 		}
 
-		if httpRes != nil {
-			defer httpRes.Body.Close()
+		var response *VerifyDataFundTransferResponse
+		bearer := fmt.Sprintf("Bearer %s", accessToken)
+		err = policy.Do(ctx, logger, func(ctx context.Context, attempt int) error {
+			ctx, cancel := withTimeout(ctx, timeout)
+			defer cancel()
 
-			if httpRes.StatusCode != http.StatusOK {
-				return nil, fmt.Errorf("error call %s body: %v", url, httpRes.Body)
+			httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(requestBodyJSON))
+			if err != nil {
+				return Permanent(fmt.Errorf("unable to New http request: %v", err))
 			}
+			httpReq.Header.Set("Authorization", bearer)
+			httpReq.Header.Set("Content-Type", "application/json")
+			httpReq.Header.Set("env-id", "OAUTH2")
+
+			httpRes, err := client.Do(httpReq)
+			if err != nil {
+				logger.Error("Error on call http request", zap.Error(err))
+				return err
+			}
+			defer httpRes.Body.Close()
 
 			body, err := io.ReadAll(httpRes.Body)
 			if err != nil {
 				logger.Error("Error on read response", zap.Error(err))
-				return nil, err
+				return err
 			}
-
-			err = json.Unmarshal(body, &response)
-
-			return response, err
+			if httpRes.StatusCode == http.StatusUnauthorized {
+				return fmt.Errorf("%w: %s", ErrUnauthorized, url)
+			}
+			if httpRes.StatusCode != http.StatusOK {
+				return StatusError(url, httpRes.StatusCode, body)
+			}
+			if err := json.Unmarshal(body, &response); err != nil {
+				logger.Error("Unmarshal", zap.Error(err))
+				return Permanent(err)
+			}
+			return nil
+		})
+		var gwErr *GatewayError
+		if err != nil && !errors.Is(err, ErrUnauthorized) && !errors.As(err, &gwErr) {
+			return nil, TransportError(err)
 		}
-
-		return nil, os.ErrNotExist
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("verify fund transfer",
+			zap.String("merchantTransID", req.MerchantTransID),
+			zap.String("responseCode", response.ResponseCode),
+			zap.String("responseMsg", response.ResponseMsg),
+		)
+		return response, nil
 	}
 }
 
-type HTTPOauthFundTransferHttpFunc func(logger *zap.Logger, auth string, wait time.Duration) (*AccessTokenResponse, error)
-
-func HTTPOauthFundTransferHttp(client *http.Client, url string, toggle config.ToggleConfiguration, retry int) HTTPOauthFundTransferHttpFunc {
-	return func(logger *zap.Logger, auth string, wait time.Duration) (*AccessTokenResponse, error) {
-		if toggle.IsTest {
-			switch toggle.Case {
-			case "P":
-				return &AccessTokenResponse{
-					DeveloperEmail: "FreedomX-10@hotmail.com",
-					TokenType:      "Bearer",
-					ClientID:       "t3rrPWnrt2jsOdjFrliIJcPslE76q09B",
-					AccessToken:    os.Getenv("mockAccessToken"),
-					Scope:          "Any",
-					ExpiresIn:      "1799",
-					Status:         "approved",
-				}, nil
-			case "F":
-				return nil, errors.New("error on HTTPOauthFundTransferHttp")
-			}
-		}
+type HTTPOauthFundTransferHttpFunc func(ctx context.Context, logger *zap.Logger, auth string) (*AccessTokenResponse, error)
 
-		var (
-			httpRes  *http.Response
-			req      *http.Request
-			err      error
-			response *AccessTokenResponse
-		)
+func HTTPOauthFundTransferHttp(client *http.Client, url string, timeout time.Duration, policy RetryPolicy) HTTPOauthFundTransferHttpFunc {
+	return func(ctx context.Context, logger *zap.Logger, auth string) (*AccessTokenResponse, error) {
+		var response *AccessTokenResponse
 
 		basicAuth := fmt.Sprintf("Basic %s", auth)
 		data := "grant_type=client_credentials"
 		dataByte := []byte(data)
-		newRetry := retry
-		for newRetry > 0 {
-			req, err = http.NewRequest(http.MethodPost, url, bytes.NewBuffer(dataByte))
+		err := policy.Do(ctx, logger, func(ctx context.Context, attempt int) error {
+			ctx, cancel := withTimeout(ctx, timeout)
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(dataByte))
 			if err != nil {
-				return nil, fmt.Errorf("unable to New http request: %v", err)
+				return Permanent(fmt.Errorf("unable to New http request: %v", err))
 			}
 			req.Header.Set("Authorization", basicAuth)
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 			req.Header.Set("env-id", "OAUTH2")
 
-			httpRes, err = client.Do(req)
+			httpRes, err := client.Do(req)
 			if err != nil {
 				logger.Error("Error on call http request", zap.Error(err))
-				retry--
-				time.Sleep(wait)
-				continue
+				return err
 			}
+			defer httpRes.Body.Close()
 
-			if httpRes != nil {
-
-				tlsInfo := req.TLS
-				if tlsInfo != nil {
-					for _, cert := range tlsInfo.PeerCertificates {
-						v, _ := json.Marshal(cert)
-						logger.Debug("Cert", zap.Any("Request", string(v)))
-
-					}
-				}
-				tlsInfo = httpRes.TLS
-				if tlsInfo != nil {
-					for _, cert := range tlsInfo.PeerCertificates {
-						v, _ := json.Marshal(cert)
-						logger.Debug("Cert", zap.Any("Response", string(v)))
-
-					}
-				}
-				if httpRes.StatusCode < 200 || httpRes.StatusCode > 299 {
-					retry--
-					body, err := io.ReadAll(httpRes.Body)
-					if err != nil {
-						logger.Error("Error on read response", zap.Error(err))
-						retry--
-						time.Sleep(wait)
-						continue
-					}
-					logger.Debug(fmt.Sprintf("HTTP status code out of range (%d) \n%s", httpRes.StatusCode, string(body)))
-
-					logger.Debug("Response Message ", zap.Any("body", string(body)))
-					time.Sleep(wait)
-					continue
-				}
-				body, err := io.ReadAll(httpRes.Body)
-				if err != nil {
-					logger.Error("Error on read response", zap.Error(err))
-					retry--
-					time.Sleep(wait)
-					continue
-				}
-
-				err = json.Unmarshal(body, &response)
-				if err != nil {
-					logger.Error("Unmarshal", zap.Error(err))
-					retry--
-					time.Sleep(wait)
-					continue
-				}
+			body, err := io.ReadAll(httpRes.Body)
+			if err != nil {
+				logger.Error("Error on read response", zap.Error(err))
+				return err
+			}
+			if httpRes.StatusCode < 200 || httpRes.StatusCode > 299 {
+				return &HTTPStatusError{URL: url, StatusCode: httpRes.StatusCode, Body: maskBody(body)}
+			}
 
-				if response.Status != OauthSuccess {
-					logger.Error(fmt.Sprintf("Call Oauth node success (%s)", response.Status))
-					retry--
-					time.Sleep(wait)
-					continue
-				}
-				if httpRes.StatusCode >= 200 && httpRes.StatusCode <= 299 {
-					break
+			var token *AccessTokenResponse
+			if err := json.Unmarshal(body, &token); err != nil {
+				logger.Error("Unmarshal", zap.Error(err))
+				return Permanent(err)
+			}
+			if token == nil || token.Status != OauthSuccess {
+				status := ""
+				if token != nil {
+					status = token.Status
 				}
-
+				logger.Error(fmt.Sprintf("Call Oauth node success (%s)", status))
+				return fmt.Errorf("oauth status %q from %s", status, url)
 			}
-
-		}
-
-		if response != nil {
-			return response, nil
+			response = token
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to request %s: %w", url, err)
 		}
-
-		return nil, fmt.Errorf("unable to request %s", url)
+		return response, nil
 	}
 }
 
-type HTTPInquiryStatusFundTransferFunc func(logger *zap.Logger, req InquiryStatusRequest, accessToken string, wait time.Duration) (*InquiryStatusResponse, error)
-
-func HTTPInquiryStatusFundTransfer(client *http.Client, url string, toggle config.ToggleConfiguration, retry int) HTTPInquiryStatusFundTransferFunc {
-	return func(logger *zap.Logger, req InquiryStatusRequest, accessToken string, wait time.Duration) (*InquiryStatusResponse, error) {
-		status := os.Getenv("statusTxn")
-		if status == "" {
-			status = "Success"
-		}
-		if toggle.IsTest {
-			switch toggle.Case {
-			case "P":
-				return &InquiryStatusResponse{
-					MerchantID:       req.MerchantID,
-					MerchantTransID:  req.MerchantTransID,
-					RsTransID:        uuid.NewString(),
-					ResponseDateTime: time.Now().Format(time.RFC3339),
-					ResponseCode:     "0000",
-					ResponseMsg:      status,
-					TxnStatus:        status,
-					SettlementDate:   time.Now().Format("20060102"),
-					FailMsg:          "FailMsg",
-				}, nil
-			case "F":
-				return nil, errors.New("error on fund transfer")
-			}
-		}
-		var (
-			httpRes  *http.Response
-			httpReq  *http.Request
-			err      error
-			response = &InquiryStatusResponse{}
-		)
+type HTTPInquiryStatusFundTransferFunc func(ctx context.Context, logger *zap.Logger, req InquiryStatusRequest, accessToken string) (*InquiryStatusResponse, error)
 
+func HTTPInquiryStatusFundTransfer(client *http.Client, url string, timeout time.Duration, policy RetryPolicy) HTTPInquiryStatusFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, req InquiryStatusRequest, accessToken string) (*InquiryStatusResponse, error) {
 		requestBodyJSON, err := json.Marshal(&req)
 		if err != nil {
 			return nil, err
 		}
 
-		newRetry := retry
+		var response *InquiryStatusResponse
+		err = policy.Do(ctx, logger, func(ctx context.Context, attempt int) error {
+			ctx, cancel := withTimeout(ctx, timeout)
+			defer cancel()
 
-		for newRetry > 0 {
-			httpReq, err = http.NewRequest(http.MethodPost, url, bytes.NewBuffer(requestBodyJSON))
+			httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(requestBodyJSON))
 			if err != nil {
-				return nil, fmt.Errorf("unable to New http request: %v", err)
+				return Permanent(fmt.Errorf("unable to New http request: %v", err))
 			}
 
 			httpReq.Header.Set("Authorization", accessToken)
 			httpReq.Header.Set("Content-Type", "application/json")
 
-			httpRes, err = client.Do(httpReq)
+			httpRes, err := client.Do(httpReq)
 			if err != nil {
 				logger.Error("Error on call http request", zap.Error(err))
-				newRetry--
-				time.Sleep(wait)
-				continue
+				return err
 			}
-			if httpRes != nil {
-				tlsInfo := httpReq.TLS
-				if tlsInfo != nil {
-					for _, cert := range tlsInfo.PeerCertificates {
-						v, _ := json.Marshal(cert)
-						logger.Debug("Cert", zap.Any("Request", string(v)))
-
-					}
-				}
-				tlsInfo = httpRes.TLS
-				if tlsInfo != nil {
-					for _, cert := range tlsInfo.PeerCertificates {
-						v, _ := json.Marshal(cert)
-						logger.Debug("Cert", zap.Any("Response", string(v)))
+			defer httpRes.Body.Close()
 
-					}
-				}
-				if httpRes.StatusCode < 200 || httpRes.StatusCode > 299 {
-					newRetry--
-					body, err := io.ReadAll(httpRes.Body)
-					if err != nil {
-						logger.Error("Error on read response", zap.Error(err))
-						retry--
-						time.Sleep(wait)
-						continue
-					}
-					logger.Error(fmt.Sprintf("HTTP status code out of range (%d) \n%s", httpRes.StatusCode, string(body)))
-					time.Sleep(wait)
-					continue
-				}
-				body, err := io.ReadAll(httpRes.Body)
+			if httpRes.StatusCode == http.StatusUnauthorized {
+				return fmt.Errorf("%w: %s", ErrUnauthorized, url)
+			}
 
-				if err != nil {
-					logger.Error("Error on read response", zap.Error(err))
-					newRetry--
-					time.Sleep(wait)
-					continue
-				}
+			body, err := io.ReadAll(httpRes.Body)
+			if err != nil {
+				logger.Error("Error on read response", zap.Error(err))
+				return err
+			}
+			if httpRes.StatusCode < 200 || httpRes.StatusCode > 299 {
+				logger.Error("HTTP status code out of range", zap.Int("status", httpRes.StatusCode))
+				return &HTTPStatusError{URL: url, StatusCode: httpRes.StatusCode, Body: maskBody(body)}
+			}
 
-				err = json.Unmarshal(body, &response)
-				if err != nil {
-					logger.Error("Unmarshal", zap.Error(err))
-					newRetry--
-					time.Sleep(wait)
-					continue
-				}
-				if httpRes.StatusCode >= 200 && httpRes.StatusCode <= 299 {
-					break
-				}
+			if err := json.Unmarshal(body, &response); err != nil {
+				logger.Error("Unmarshal", zap.Error(err))
+				return Permanent(err)
 			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
-
-		return response, err
+		return response, nil
 	}
 }
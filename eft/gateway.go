@@ -0,0 +1,259 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/cache"
+	"go.uber.org/zap"
+)
+
+const (
+	BreakerClosed   = "CLOSED"
+	BreakerOpen     = "OPEN"
+	BreakerHalfOpen = "HALF_OPEN"
+)
+
+// ErrCircuitOpen is returned without calling the bank while the breaker is
+// open, or half-open with its probes already in flight. The request never
+// left, so it is safe to treat the bank as not having seen it.
+var ErrCircuitOpen = errors.New("eft circuit breaker is open")
+
+// WaitRateLimitFunc blocks until the next bank call may start.
+type WaitRateLimitFunc func(ctx context.Context, logger *zap.Logger) error
+
+// TokenBucket allows rate calls per second on average and up to burst at
+// once, within this process.
+func TokenBucket(rate float64, burst int) WaitRateLimitFunc {
+	if burst < 1 {
+		burst = 1
+	}
+	var mu sync.Mutex
+	tokens := float64(burst)
+	last := time.Now()
+
+	return func(ctx context.Context, logger *zap.Logger) error {
+		if rate <= 0 {
+			return nil
+		}
+		for {
+			mu.Lock()
+			now := time.Now()
+			tokens = math.Min(float64(burst), tokens+now.Sub(last).Seconds()*rate)
+			last = now
+			if tokens >= 1 {
+				tokens--
+				mu.Unlock()
+				return nil
+			}
+			wait := time.Duration((1 - tokens) / rate * float64(time.Second))
+			mu.Unlock()
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RedisRateLimit shares the limit between instances by counting calls per
+// second under EFT:RATE:<unix second>. It is a fixed window, so up to twice
+// the rate can pass around a second boundary. When Redis fails, calls fall
+// back to the local bucket rather than stopping payments.
+func RedisRateLimit(incr cache.InCrRedisFunc, expire cache.SetExpireFunc, rate float64, fallback WaitRateLimitFunc) WaitRateLimitFunc {
+	limit := int64(math.Max(1, rate))
+	return func(ctx context.Context, logger *zap.Logger) error {
+		if rate <= 0 {
+			return nil
+		}
+		for {
+			now := time.Now()
+			key := fmt.Sprintf(cache.EFTRateKey, now.Unix())
+			count, err := incr(ctx, key)
+			if err != nil {
+				logger.Warn("Error InCrRedis eft rate, using local limiter", zap.Error(err))
+				return fallback(ctx, logger)
+			}
+			if count == 1 {
+				if err := expire(ctx, key, 2*time.Second); err != nil {
+					logger.Warn("Error SetExpire eft rate", zap.Error(err))
+				}
+			}
+			if count <= limit {
+				return nil
+			}
+			if err := sleep(ctx, now.Truncate(time.Second).Add(time.Second).Sub(now)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// BreakerMetrics is a snapshot of a CircuitBreaker's counters.
+type BreakerMetrics struct {
+	State    string
+	Requests int64
+	Failures int64
+	Rejected int64
+	Trips    int64
+}
+
+// CircuitBreaker opens after FailureThreshold consecutive failures, rejects
+// calls for OpenTimeout, then lets HalfOpenMax probes through: a successful
+// probe closes it again, a failed one reopens it.
+type CircuitBreaker struct {
+	cfg    config.BreakerConfig
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probes   int
+	metrics  BreakerMetrics
+}
+
+func NewCircuitBreaker(cfg config.BreakerConfig, logger *zap.Logger) *CircuitBreaker {
+	if cfg.HalfOpenMax < 1 {
+		cfg.HalfOpenMax = 1
+	}
+	return &CircuitBreaker{cfg: cfg, logger: logger, now: time.Now, state: BreakerClosed}
+}
+
+// Allow reserves a call, or returns ErrCircuitOpen. Every allowed call must
+// be followed by Record, or by Release when it says nothing about the bank.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.setState(BreakerHalfOpen)
+	}
+	switch {
+	case b.state == BreakerOpen,
+		b.state == BreakerHalfOpen && b.probes >= b.cfg.HalfOpenMax:
+		b.metrics.Rejected++
+		return ErrCircuitOpen
+	case b.state == BreakerHalfOpen:
+		b.probes++
+	}
+	b.metrics.Requests++
+	return nil
+}
+
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if success {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+	b.metrics.Failures++
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.cfg.FailureThreshold > 0 && b.failures >= b.cfg.FailureThreshold) {
+		b.metrics.Trips++
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// Release gives back a call reserved by Allow without counting it either
+// way, so a cancelled half-open probe frees its slot and leaves the state.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *CircuitBreaker) Metrics() BreakerMetrics {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	metrics := b.metrics
+	metrics.State = b.state
+	return metrics
+}
+
+func (b *CircuitBreaker) setState(state string) {
+	from := b.state
+	b.state, b.probes = state, 0
+	if state == BreakerClosed {
+		b.failures = 0
+	}
+	fields := []zap.Field{
+		zap.String("from", from),
+		zap.String("to", state),
+		zap.Int("consecutiveFailures", b.failures),
+		zap.Int64("requests", b.metrics.Requests),
+		zap.Int64("failures", b.metrics.Failures),
+		zap.Int64("rejected", b.metrics.Rejected),
+		zap.Int64("trips", b.metrics.Trips),
+	}
+	if state == BreakerOpen {
+		b.logger.Warn("eft circuit breaker opened", fields...)
+		return
+	}
+	b.logger.Info("eft circuit breaker state", fields...)
+}
+
+// breakerFailure counts transport errors and 5xx/429 answers against the
+// bank; a 4xx says nothing about its health. A cancelled caller is neither
+// and is released instead of recorded.
+func breakerFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests
+}
+
+type gatewayTransport struct {
+	next    http.RoundTripper
+	limit   WaitRateLimitFunc
+	breaker *CircuitBreaker
+	logger  *zap.Logger
+}
+
+// GatewayTransport puts the rate limiter and circuit breaker in front of
+// every eft HTTP call made through next. Either may be nil. The breaker is
+// asked first, so a rejected call does not use up a rate token.
+func GatewayTransport(next http.RoundTripper, limit WaitRateLimitFunc, breaker *CircuitBreaker, logger *zap.Logger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &gatewayTransport{next: next, limit: limit, breaker: breaker, logger: logger}
+}
+
+func (t *gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.breaker != nil {
+		if err := t.breaker.Allow(); err != nil {
+			t.logger.Warn("eft call rejected", zap.String("url", req.URL.Path), zap.Error(err))
+			return nil, err
+		}
+	}
+	if t.limit != nil {
+		if err := t.limit(req.Context(), t.logger); err != nil {
+			if t.breaker != nil {
+				t.breaker.Release()
+			}
+			return nil, err
+		}
+	}
+	res, err := t.next.RoundTrip(req)
+	if t.breaker != nil {
+		if errors.Is(err, context.Canceled) {
+			t.breaker.Release()
+		} else {
+			t.breaker.Record(!breakerFailure(res, err))
+		}
+	}
+	return res, err
+}
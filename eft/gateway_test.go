@@ -0,0 +1,99 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+func TestGatewayTransportCircuitBreaker(t *testing.T) {
+	var status, calls int32 = http.StatusServiceUnavailable, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	breaker := NewCircuitBreaker(config.BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}, zap.NewNop())
+	breaker.now = func() time.Time { return now }
+	client := &http.Client{Transport: GatewayTransport(nil, TokenBucket(1000, 10), breaker, zap.NewNop())}
+
+	call := func() error {
+		res, err := client.Get(server.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+
+	assert.Equal(t, nil, call())
+	assert.Equal(t, nil, call())
+	assert.Equal(t, BreakerOpen, breaker.Metrics().State)
+	assert.Equal(t, true, errors.Is(call(), ErrCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// The probe after OpenTimeout fails and reopens the breaker.
+	now = now.Add(time.Minute)
+	assert.Equal(t, nil, call())
+	assert.Equal(t, BreakerOpen, breaker.Metrics().State)
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	atomic.StoreInt32(&status, http.StatusOK)
+	assert.Equal(t, nil, call())
+	assert.Equal(t, BreakerMetrics{State: BreakerClosed, Requests: 4, Failures: 3, Rejected: 1, Trips: 2}, breaker.Metrics())
+	assert.Equal(t, false, NewRetryPolicy(config.RetryConfig{}).Retryable(ErrCircuitOpen))
+}
+
+func TestGatewayTransportCancelledProbe(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	now := time.Now()
+	breaker := NewCircuitBreaker(config.BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, zap.NewNop())
+	breaker.now = func() time.Time { return now }
+	assert.Equal(t, nil, breaker.Allow())
+	breaker.Record(false)
+	now = now.Add(time.Minute)
+
+	// The caller gives up on the only probe: the slot is freed and the
+	// breaker stays half-open, neither closed nor reopened.
+	var limited int32
+	limit := func(ctx context.Context, logger *zap.Logger) error {
+		atomic.AddInt32(&limited, 1)
+		return nil
+	}
+	client := &http.Client{Transport: GatewayTransport(nil, limit, breaker, zap.NewNop())}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, err := client.Do(req)
+	assert.Equal(t, true, errors.Is(err, context.Canceled))
+	assert.Equal(t, BreakerHalfOpen, breaker.Metrics().State)
+	assert.Equal(t, nil, breaker.Allow())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&limited))
+
+	// With the probe slot taken, calls are rejected before the limiter.
+	_, err = client.Get(server.URL)
+	assert.Equal(t, true, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&limited))
+}
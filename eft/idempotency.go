@@ -0,0 +1,72 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-redis/redis/v9"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/cache"
+	"go.uber.org/zap"
+)
+
+// ErrTransferInProgress is returned for a duplicate request while the first
+// one has not reached the bank's confirm step yet and is not yet abandoned.
+var ErrTransferInProgress = errors.New("fund transfer already in progress")
+
+// IdempotentTransfer reserves PAYMENT:<MerchantTransID> before TransferFunc
+// runs, backed by the fund_transfer primary key. A duplicate request never
+// reaches the bank again: it gets the stored result, or ResolveTransferFunc
+// when the first attempt ended without a final status.
+func IdempotentTransfer(
+	cmd redis.Cmdable,
+	cfg config.EFTConfig,
+	TransferFunc TransferFunc,
+	GetFundTransferFunc GetFundTransferFunc,
+	ResolveTransferFunc ResolveTransferFunc,
+) TransferFunc {
+	trySetNX := cache.TrySetRedisNX(cmd)
+	deleteRedis := cache.DeleteRedis(cmd)
+
+	return func(ctx context.Context, logger *zap.Logger, req TransferRequest) (*TransferResult, error) {
+		if req.MerchantTransID == "" {
+			return nil, errors.New("merchantTransID is required")
+		}
+		logger = logger.With(zap.String("merchantTransID", req.MerchantTransID))
+		key := fmt.Sprintf(cache.PaymentKey, req.MerchantTransID)
+
+		reserved, err := trySetNX(ctx, key, StateInitiated, cfg.IdempotencyTTL)
+		if err != nil {
+			logger.Error("Error reserve merchantTransID", zap.Error(err))
+			return nil, err
+		}
+		if reserved {
+			result, err := TransferFunc(ctx, logger, req)
+			if result == nil && err != nil && !errors.Is(err, ErrDuplicateTransfer) {
+				// Nothing was recorded, so let a retry start over.
+				if delErr := deleteRedis(ctx, key); delErr != nil {
+					logger.Error("Error release merchantTransID", zap.Error(delErr))
+				}
+				return nil, err
+			}
+			if !errors.Is(err, ErrDuplicateTransfer) {
+				return result, err
+			}
+		}
+
+		logger.Info("duplicate fund transfer request")
+		record, err := GetFundTransferFunc(ctx, logger, req.MerchantTransID)
+		if err != nil {
+			if errors.Is(err, ErrTransferNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrTransferInProgress, req.MerchantTransID)
+			}
+			return nil, err
+		}
+
+		if IsFinalState(record.Status) {
+			return resultFromRecord(*record), nil
+		}
+		return ResolveTransferFunc(ctx, logger, *record)
+	}
+}
@@ -0,0 +1,85 @@
+package eft_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft/mockbank"
+	"go.uber.org/zap"
+)
+
+func TestIdempotentTransfer(t *testing.T) {
+	cfg := config.EFTConfig{IdempotencyTTL: time.Hour, AbandonAfter: time.Minute}
+	failingTransfer := func(ctx context.Context, logger *zap.Logger, req eft.TransferRequest) (*eft.TransferResult, error) {
+		return nil, errors.New("worker crashed")
+	}
+
+	tests := []struct {
+		name string
+		// states is the stored history of T1 before the duplicate request.
+		states  []string
+		idleFor time.Duration
+		want    string
+		wantErr error
+	}{
+		{name: "settled", states: []string{eft.StateInitiated, eft.StateVerified, eft.StateSubmitted, eft.StateSuccess}, want: eft.StateSuccess},
+		{name: "verified, worker may be alive", states: []string{eft.StateInitiated, eft.StateVerified}, want: eft.StateVerified, wantErr: eft.ErrTransferInProgress},
+		{name: "verified, abandoned", states: []string{eft.StateInitiated, eft.StateVerified}, idleFor: time.Hour, want: eft.StateFailed},
+		{name: "initiated, abandoned", states: []string{eft.StateInitiated}, idleFor: time.Hour, want: eft.StateFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+			store := &memoryStore{
+				states:    map[string][]string{"T1": tt.states},
+				updatedAt: map[string]time.Time{"T1": time.Now().Add(-tt.idleFor)},
+			}
+			transfer := eft.IdempotentTransfer(cmd, cfg, failingTransfer, store.get(), eft.ResolveTransfer(cfg, nil, nil, nil, store.transit()))
+
+			// The crashed first attempt still holds the reservation.
+			assert.Equal(t, nil, cmd.Set(context.Background(), "PAYMENT:T1", eft.StateInitiated, time.Hour).Err())
+			result, err := transfer(context.Background(), zap.NewNop(), transferRequest("T1"))
+			assert.Equal(t, true, errors.Is(err, tt.wantErr), "err: %v", err)
+			assert.Equal(t, tt.want, result.Status)
+			assert.Equal(t, tt.want, store.states["T1"][len(store.states["T1"])-1])
+		})
+	}
+}
+
+func TestIdempotentTransferPaysOnce(t *testing.T) {
+	cmd := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	bank := mockbank.New(mockbank.Scenario{})
+	store := &memoryStore{states: map[string][]string{}}
+	pay, closeBank := newTransfer(bank, store)
+	defer closeBank()
+	resolve := func(ctx context.Context, logger *zap.Logger, record eft.FundTransferRecord) (*eft.TransferResult, error) {
+		t.Fatal("settled transfers are not resolved again")
+		return nil, nil
+	}
+	transfer := eft.IdempotentTransfer(cmd, config.EFTConfig{IdempotencyTTL: time.Hour}, pay, store.get(), resolve)
+
+	for i := 0; i < 2; i++ {
+		result, err := transfer(context.Background(), zap.NewNop(), transferRequest("T1"))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, eft.StateSuccess, result.Status)
+	}
+	assert.Equal(t, 1, bank.Calls(mockbank.PathVerify))
+	assert.Equal(t, 1, bank.Calls(mockbank.PathTransfer))
+}
+
+func TestAbandonTransferRace(t *testing.T) {
+	// The worker moved T1 on to SUBMITTED after the resolver read it as
+	// VERIFIED; the confirm may be in flight, so it must not be failed.
+	store := &memoryStore{states: map[string][]string{"T1": {eft.StateInitiated, eft.StateVerified, eft.StateSubmitted}}}
+	resolve := eft.ResolveTransfer(config.EFTConfig{AbandonAfter: time.Minute}, nil, nil, nil, store.transit())
+	_, err := resolve(context.Background(), zap.NewNop(), eft.FundTransferRecord{MerchantTransID: "T1", Status: eft.StateVerified, UpdatedAt: time.Now().Add(-time.Hour)})
+	assert.Equal(t, true, errors.Is(err, eft.ErrInvalidTransition))
+	assert.Equal(t, eft.StateSubmitted, store.states["T1"][2])
+}
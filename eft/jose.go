@@ -0,0 +1,226 @@
+package eft
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgPS256 = "PS256"
+	AlgES256 = "ES256"
+
+	jweAlg = jose.RSA_OAEP_256
+	jweEnc = jose.A256GCM
+)
+
+// ErrSignatureInvalid is a missing or bad signature on a bank response. The
+// response is dropped, so nothing unverified reaches the caller.
+var ErrSignatureInvalid = errors.New("bank response signature invalid")
+
+// JWSSigner signs payloads as compact JWS (RFC 7515).
+type JWSSigner struct {
+	signer jose.Signer
+}
+
+// NewJWSSigner fails when alg does not fit key, so a bad configuration shows
+// at startup rather than on the first call.
+func NewJWSSigner(key crypto.Signer, alg, keyID string) (*JWSSigner, error) {
+	if !supportedAlg(alg) {
+		return nil, fmt.Errorf("unsupported JWS alg %q", alg)
+	}
+	opts := &jose.SignerOptions{}
+	if keyID != "" {
+		opts = opts.WithHeader("kid", keyID)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(alg), Key: key}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("JWS alg %s: %w", alg, err)
+	}
+	return &JWSSigner{signer: signer}, nil
+}
+
+func (s *JWSSigner) Sign(payload []byte) (string, error) {
+	jws, err := s.signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+// SignDetached returns the JWS with its payload section left empty, for a
+// signature header next to the plain body (RFC 7515 appendix F).
+func (s *JWSSigner) SignDetached(payload []byte) (string, error) {
+	jws, err := s.signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.DetachedCompactSerialize()
+}
+
+// JWSVerifier checks compact JWS made with Key, accepting only Alg.
+type JWSVerifier struct {
+	Key crypto.PublicKey
+	Alg string
+}
+
+// Verify returns the payload of a valid token, or ErrSignatureInvalid.
+func (v JWSVerifier) Verify(token string) ([]byte, error) {
+	if strings.Count(token, ".") != 2 {
+		return nil, fmt.Errorf("%w: malformed JWS", ErrSignatureInvalid)
+	}
+	jws, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	if err := v.checkAlg(jws); err != nil {
+		return nil, err
+	}
+	payload, err := jws.Verify(v.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	return payload, nil
+}
+
+// VerifyDetached checks a detached JWS against payload.
+func (v JWSVerifier) VerifyDetached(token string, payload []byte) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return fmt.Errorf("%w: malformed detached JWS", ErrSignatureInvalid)
+	}
+	jws, err := jose.ParseDetached(token, payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	if err := v.checkAlg(jws); err != nil {
+		return err
+	}
+	if err := jws.DetachedVerify(payload, v.Key); err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	return nil
+}
+
+// checkAlg never lets the token pick its algorithm.
+func (v JWSVerifier) checkAlg(jws *jose.JSONWebSignature) error {
+	if len(jws.Signatures) != 1 || jws.Signatures[0].Header.Algorithm != v.Alg {
+		return fmt.Errorf("%w: unexpected header alg", ErrSignatureInvalid)
+	}
+	return nil
+}
+
+// EncryptJWE wraps payload as compact JWE with RSA-OAEP-256 and A256GCM.
+func EncryptJWE(payload []byte, key *rsa.PublicKey, keyID string) (string, error) {
+	encrypter, err := jose.NewEncrypter(jweEnc, jose.Recipient{Algorithm: jweAlg, Key: key, KeyID: keyID}, nil)
+	if err != nil {
+		return "", err
+	}
+	jwe, err := encrypter.Encrypt(payload)
+	if err != nil {
+		return "", err
+	}
+	return jwe.CompactSerialize()
+}
+
+// DecryptJWE opens a compact JWE made by EncryptJWE's algorithms only.
+func DecryptJWE(token string, key *rsa.PrivateKey) ([]byte, error) {
+	if strings.Count(token, ".") != 4 {
+		return nil, errors.New("malformed JWE")
+	}
+	jwe, err := jose.ParseEncrypted(token)
+	if err != nil {
+		return nil, err
+	}
+	enc, _ := jwe.Header.ExtraHeaders["enc"].(string)
+	if jwe.Header.Algorithm != string(jweAlg) || enc != string(jweEnc) {
+		return nil, fmt.Errorf("unsupported JWE alg %q enc %q", jwe.Header.Algorithm, enc)
+	}
+	return jwe.Decrypt(key)
+}
+
+func supportedAlg(alg string) bool {
+	return alg == AlgRS256 || alg == AlgPS256 || alg == AlgES256
+}
+
+// checkCurve allows ECDSA keys on P-256 only, the curve ES256 is defined for.
+func checkCurve(key interface{}) error {
+	var curve elliptic.Curve
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		curve = k.Curve
+	case *ecdsa.PublicKey:
+		curve = k.Curve
+	default:
+		return nil
+	}
+	if curve != elliptic.P256() {
+		return fmt.Errorf("unsupported ECDSA curve %s, ES256 needs P-256", curve.Params().Name)
+	}
+	return nil
+}
+
+// ParsePrivateKey reads a PKCS#1, PKCS#8 or SEC 1 PEM private key. ECDSA
+// keys must be on P-256.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		if err := checkCurve(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	if err := checkCurve(signer); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// ParsePublicKey reads a PKIX public key or the key of a certificate, in PEM.
+// ECDSA keys must be on P-256.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM public key found")
+	}
+	var key crypto.PublicKey
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	} else {
+		var err error
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkCurve(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,103 @@
+package eft
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+)
+
+func ecKeyPEM(t *testing.T, curve elliptic.Curve) (private, public []byte) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	assert.Equal(t, nil, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.Equal(t, nil, err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Equal(t, nil, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+}
+
+func TestJWSES256(t *testing.T) {
+	private, public := ecKeyPEM(t, elliptic.P256())
+	key, err := ParsePrivateKey(private)
+	assert.Equal(t, nil, err)
+	bankKey, err := ParsePublicKey(public)
+	assert.Equal(t, nil, err)
+
+	signer, err := NewJWSSigner(key, AlgES256, "k1")
+	assert.Equal(t, nil, err)
+	token, err := signer.Sign([]byte(`{"a":1}`))
+	assert.Equal(t, nil, err)
+	payload, err := JWSVerifier{Key: bankKey, Alg: AlgES256}.Verify(token)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"a":1}`, string(payload))
+
+	detached, err := signer.SignDetached([]byte(`{"a":1}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, JWSVerifier{Key: bankKey, Alg: AlgES256}.VerifyDetached(detached, []byte(`{"a":1}`)))
+	err = JWSVerifier{Key: bankKey, Alg: AlgES256}.VerifyDetached(detached, []byte(`{"a":2}`))
+	assert.Equal(t, true, errors.Is(err, ErrSignatureInvalid))
+}
+
+func TestParseKeyCurve(t *testing.T) {
+	private, public := ecKeyPEM(t, elliptic.P384())
+	_, err := ParsePrivateKey(private)
+	assert.Contains(t, err.Error(), "P-256")
+	_, err = ParsePublicKey(public)
+	assert.Contains(t, err.Error(), "P-256")
+}
+
+func TestJOSESignerAlgMismatch(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	_, public := ecKeyPEM(t, elliptic.P256())
+
+	_, _, err = JOSESigner(config.SigningConfig{Mode: SigningDetached, Alg: AlgES256, BankAlg: AlgES256, BankPublicKey: public}, private)
+	assert.Error(t, err)
+	_, _, err = JOSESigner(config.SigningConfig{Mode: SigningDetached, Alg: AlgRS256, BankAlg: "HS256", BankPublicKey: public}, private)
+	assert.Error(t, err)
+}
+
+func TestJWSVerifierRejectsOtherAlg(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+	signer, err := NewJWSSigner(rsaKey, AlgPS256, "")
+	assert.Equal(t, nil, err)
+	token, err := signer.Sign([]byte(`{}`))
+	assert.Equal(t, nil, err)
+
+	// A valid signature under an alg other than the configured one is refused.
+	_, err = JWSVerifier{Key: &rsaKey.PublicKey, Alg: AlgRS256}.Verify(token)
+	assert.Equal(t, true, errors.Is(err, ErrSignatureInvalid))
+	_, err = JWSVerifier{Key: &rsaKey.PublicKey, Alg: AlgRS256}.Verify("e30.e30")
+	assert.Equal(t, true, errors.Is(err, ErrSignatureInvalid))
+}
+
+func TestDecryptJWE(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+	token, err := EncryptJWE([]byte(`{"a":1}`), &rsaKey.PublicKey, "bank")
+	assert.Equal(t, nil, err)
+	plain, err := DecryptJWE(token, rsaKey)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"a":1}`, string(plain))
+
+	// RSA1_5 is decryptable by the library but not accepted here.
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA1_5, Key: &rsaKey.PublicKey}, nil)
+	assert.Equal(t, nil, err)
+	jwe, err := encrypter.Encrypt([]byte(`{"a":1}`))
+	assert.Equal(t, nil, err)
+	token, err = jwe.CompactSerialize()
+	assert.Equal(t, nil, err)
+	_, err = DecryptJWE(token, rsaKey)
+	assert.Contains(t, err.Error(), "unsupported JWE alg")
+}
@@ -0,0 +1,430 @@
+// Package mockbank is a fake fund transfer gateway serving the OAuth, verify,
+// transfer and inquiry endpoints over HTTP, for tests and local runs.
+package mockbank
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+)
+
+const (
+	PathOAuth    = "/oauth/token"
+	PathVerify   = "/fundtransfer/verify"
+	PathTransfer = "/fundtransfer/confirm"
+	PathInquiry  = "/fundtransfer/inquiry"
+
+	// The mock's own codes; eft.ResponseCodes does not map them, as the
+	// bank's spec does not list them.
+	CodeDuplicate = "3001"
+	CodeNotFound  = "4004"
+)
+
+// Step is one scripted answer. Zero values answer 200 with code 0000 and,
+// for inquiry, txnStatus Success.
+type Step struct {
+	Status       int           `json:"status,omitempty"`
+	Delay        time.Duration `json:"delay,omitempty"`
+	ResponseCode string        `json:"responseCode,omitempty"`
+	ResponseMsg  string        `json:"responseMsg,omitempty"`
+	TxnStatus    string        `json:"txnStatus,omitempty"`
+	FailMsg      string        `json:"failMsg,omitempty"`
+	Body         string        `json:"body,omitempty"`
+}
+
+// UnmarshalJSON takes delay as a duration string such as "2s".
+func (s *Step) UnmarshalJSON(data []byte) error {
+	type step Step
+	aux := struct {
+		*step
+		Delay string `json:"delay,omitempty"`
+	}{step: (*step)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Delay != "" {
+		delay, err := time.ParseDuration(aux.Delay)
+		if err != nil {
+			return fmt.Errorf("invalid delay %q: %w", aux.Delay, err)
+		}
+		s.Delay = delay
+	}
+	return nil
+}
+
+// Scenario scripts each endpoint. Steps are used in order and the last one
+// repeats; an empty list always answers with the zero Step. OAuth steps are
+// taken from the default scenario only.
+type Scenario struct {
+	OAuth    []Step `json:"oauth,omitempty"`
+	Verify   []Step `json:"verify,omitempty"`
+	Transfer []Step `json:"transfer,omitempty"`
+	Inquiry  []Step `json:"inquiry,omitempty"`
+}
+
+// ScenarioFunc picks the scenario for a transfer from its verify request.
+// Returning false falls back to the server's default scenario.
+type ScenarioFunc func(req eft.VerifyDataFundTransferRequest) (Scenario, bool)
+
+type transfer struct {
+	scenario  Scenario
+	rsTransID string
+	confirmed bool
+	calls     map[string]int
+}
+
+type Server struct {
+	mu          sync.Mutex
+	def         Scenario
+	scenarios   map[string]Scenario
+	match       ScenarioFunc
+	transfers   map[string]*transfer
+	byRsTransID map[string]string
+	calls       map[string]int
+	tokens      int
+}
+
+func New(def Scenario) *Server {
+	return &Server{
+		def:         def,
+		scenarios:   map[string]Scenario{},
+		transfers:   map[string]*transfer{},
+		byRsTransID: map[string]string{},
+		calls:       map[string]int{},
+	}
+}
+
+// Script is the JSON form of a server: a default scenario, scenarios keyed
+// by MerchantTransID and rules tried in order for all other transfers.
+type Script struct {
+	Default   Scenario            `json:"default"`
+	Transfers map[string]Scenario `json:"transfers,omitempty"`
+	Rules     []Rule              `json:"rules,omitempty"`
+}
+
+func NewFromScript(data []byte) (*Server, error) {
+	var script Script
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("invalid mock bank script: %w", err)
+	}
+	s := New(script.Default)
+	for merchantTransID, scenario := range script.Transfers {
+		s.Set(merchantTransID, scenario)
+	}
+	if len(script.Rules) > 0 {
+		match, err := MatchRules(script.Rules)
+		if err != nil {
+			return nil, err
+		}
+		s.Match(match)
+	}
+	return s, nil
+}
+
+// Set scripts the transfer with the given MerchantTransID.
+func (s *Server) Set(merchantTransID string, scenario Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios[merchantTransID] = scenario
+}
+
+// Match picks scenarios by rule for transfers without one set by MerchantTransID.
+func (s *Server) Match(match ScenarioFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.match = match
+}
+
+// Calls is the number of requests served on path.
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[path]
+}
+
+// Start serves on a random local port; close the returned server when done.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+// Configure points cfg's endpoint URLs at a mock bank served on baseURL.
+func Configure(cfg *config.EFTConfig, baseURL string) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	cfg.OAuthURL = baseURL + PathOAuth
+	cfg.VerifyURL = baseURL + PathVerify
+	cfg.TransferURL = baseURL + PathTransfer
+	cfg.InquiryURL = baseURL + PathInquiry
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	s.calls[r.URL.Path]++
+	s.mu.Unlock()
+
+	switch r.URL.Path {
+	case PathOAuth:
+		s.oauth(w, r)
+	case PathVerify:
+		s.verify(w, r)
+	case PathTransfer:
+		s.transfer(w, r)
+	case PathInquiry:
+		s.inquiry(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) oauth(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	step := nextStep(s.def.OAuth, s.calls[PathOAuth])
+	s.tokens++
+	token := fmt.Sprintf("mock-token-%d", s.tokens)
+	s.mu.Unlock()
+
+	respond(w, r, step, eft.AccessTokenResponse{
+		TokenType:   "Bearer",
+		ClientID:    "mockbank",
+		AccessToken: token,
+		Scope:       "Any",
+		ExpiresIn:   "1799",
+		Status:      eft.OauthSuccess,
+	})
+}
+
+func (s *Server) verify(w http.ResponseWriter, r *http.Request) {
+	var req eft.VerifyDataFundTransferRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	t, ok := s.transfers[req.MerchantTransID]
+	duplicate := ok && t.confirmed
+	if !ok {
+		t = &transfer{scenario: s.scenarioFor(req), calls: map[string]int{}}
+		s.transfers[req.MerchantTransID] = t
+	}
+	t.calls[PathVerify]++
+	if !duplicate {
+		// RsTransIDs are derived from the MerchantTransID so runs are repeatable.
+		t.rsTransID = "RS" + req.MerchantTransID
+		if t.calls[PathVerify] > 1 {
+			t.rsTransID = fmt.Sprintf("RS%s-%d", req.MerchantTransID, t.calls[PathVerify])
+		}
+		s.byRsTransID[t.rsTransID] = req.MerchantTransID
+	}
+	step := nextStep(t.scenario.Verify, t.calls[PathVerify])
+	rsTransID := t.rsTransID
+	s.mu.Unlock()
+
+	if duplicate {
+		step = Step{ResponseCode: CodeDuplicate, ResponseMsg: "Duplicate merchantTransID"}
+	}
+	respond(w, r, step, eft.VerifyDataFundTransferResponse{
+		MerchantID:       req.MerchantID,
+		MerchantTransID:  req.MerchantTransID,
+		RsTransID:        rsTransID,
+		ResponseDateTime: time.Now().Format(time.RFC3339),
+		ResponseCode:     code(step.ResponseCode),
+		ResponseMsg:      msg(step.ResponseMsg),
+		ProxyType:        req.ProxyType,
+		ProxyValue:       req.ProxyValue,
+		ToBankCode:       req.ToBankCode,
+		ToAccNameTH:      "ทดสอบ ระบบ",
+		ToAccNameEN:      "TEST SYSTEM",
+		TransType:        req.TransType,
+		FromAccountNo:    req.FromAccountNo,
+		SenderName:       req.SenderName,
+		SenderTaxID:      req.SenderTaxID,
+		TypeOfSender:     req.TypeOfSender,
+		Amount:           req.Amount,
+	})
+}
+
+// transfer records the transfer before any scripted delay, so a client that
+// times out leaves it taken by the bank, as a real lost response would.
+func (s *Server) transfer(w http.ResponseWriter, r *http.Request) {
+	var req eft.FundTransferRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	t, ok := s.transfers[req.MerchantTransID]
+	if !ok || t.rsTransID != req.RsTransID {
+		s.mu.Unlock()
+		respond(w, r, Step{ResponseCode: CodeNotFound, ResponseMsg: "Verify not found"}, eft.FundTransferResponse{
+			MerchantID:      req.MerchantID,
+			MerchantTransID: req.MerchantTransID,
+			RsTransID:       req.RsTransID,
+			ResponseCode:    CodeNotFound,
+		})
+		return
+	}
+	duplicate := t.confirmed
+	t.calls[PathTransfer]++
+	step := nextStep(t.scenario.Transfer, t.calls[PathTransfer])
+	accepted := code(step.ResponseCode) == eft.SuccessFundTransfer || step.ResponseCode == eft.OtherExceptionFundTransfer
+	if (step.Status == 0 || step.Status == http.StatusOK) && accepted {
+		t.confirmed = true
+	}
+	s.mu.Unlock()
+
+	if duplicate {
+		step = Step{ResponseCode: CodeDuplicate, ResponseMsg: "Duplicate merchantTransID"}
+	}
+	respond(w, r, step, eft.FundTransferResponse{
+		MerchantID:       req.MerchantID,
+		MerchantTransID:  req.MerchantTransID,
+		RsTransID:        req.RsTransID,
+		ResponseDateTime: time.Now().Format(time.RFC3339),
+		ResponseCode:     code(step.ResponseCode),
+		ResponseMsg:      msg(step.ResponseMsg),
+		SettlementDate:   time.Now().Format("20060102"),
+	})
+}
+
+func (s *Server) inquiry(w http.ResponseWriter, r *http.Request) {
+	var req eft.InquiryStatusRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	merchantTransID := req.MerchantTransID
+	if merchantTransID == "" {
+		merchantTransID = s.byRsTransID[req.RsTransID]
+	}
+	t, ok := s.transfers[merchantTransID]
+	var step Step
+	if ok {
+		t.calls[PathInquiry]++
+		step = nextStep(t.scenario.Inquiry, t.calls[PathInquiry])
+		if !t.confirmed {
+			step.TxnStatus = eft.TxnStatusFail
+			step.FailMsg = "Transaction not found"
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		step = Step{ResponseCode: CodeNotFound, ResponseMsg: "Transaction not found", TxnStatus: eft.TxnStatusFail, FailMsg: "Transaction not found"}
+	}
+	txnStatus := step.TxnStatus
+	if txnStatus == "" {
+		txnStatus = eft.TxnStatusSuccess
+	}
+	response := eft.InquiryStatusResponse{
+		MerchantID:       req.MerchantID,
+		MerchantTransID:  merchantTransID,
+		RsTransID:        req.RsTransID,
+		ResponseDateTime: time.Now().Format(time.RFC3339),
+		ResponseCode:     code(step.ResponseCode),
+		ResponseMsg:      msg(step.ResponseMsg),
+		TxnStatus:        txnStatus,
+		FailMsg:          step.FailMsg,
+	}
+	if txnStatus == eft.TxnStatusSuccess {
+		response.SettlementDate = time.Now().Format("20060102")
+	}
+	respond(w, r, step, response)
+}
+
+// scenarioFor must be called with s.mu held.
+func (s *Server) scenarioFor(req eft.VerifyDataFundTransferRequest) Scenario {
+	if scenario, ok := s.scenarios[req.MerchantTransID]; ok {
+		return scenario
+	}
+	if s.match != nil {
+		if scenario, ok := s.match(req); ok {
+			return scenario
+		}
+	}
+	return s.def
+}
+
+// nextStep returns the n-th (1-based) step, repeating the last one.
+func nextStep(steps []Step, n int) Step {
+	if len(steps) == 0 {
+		return Step{}
+	}
+	if n > len(steps) {
+		n = len(steps)
+	}
+	return steps[n-1]
+}
+
+func code(responseCode string) string {
+	if responseCode == "" {
+		return eft.SuccessFundTransfer
+	}
+	return responseCode
+}
+
+func msg(responseMsg string) string {
+	if responseMsg == "" {
+		return "Success"
+	}
+	return responseMsg
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// respond waits out the step's delay, unless the client gives up first, then
+// writes the step's status with either its raw body or v.
+func respond(w http.ResponseWriter, r *http.Request, step Step, v interface{}) {
+	if step.Delay > 0 {
+		timer := time.NewTimer(step.Delay)
+		defer timer.Stop()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timer.C:
+		}
+	}
+
+	status := step.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if step.Body != "" {
+		_, _ = io.WriteString(w, step.Body)
+		return
+	}
+	if status == http.StatusOK {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
@@ -0,0 +1,166 @@
+package mockbank
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+)
+
+const (
+	OutcomeSuccess        = "success"
+	OutcomeReject         = "reject"
+	OutcomeDelayedSuccess = "delayed_success"
+	OutcomeFailAfter      = "fail_after"
+	OutcomeUnavailable    = "unavailable"
+)
+
+// Rule maps verify requests to a scenario. MerchantTransID and Account are
+// regular expressions, Account is tried on ProxyValue and FromAccountNo, and
+// the amount bounds are inclusive. Empty criteria match anything.
+//
+// A rule either scripts Scenario directly or names an Outcome:
+//   - reject: verify answers ResponseCode/ResponseMsg
+//   - delayed_success: Inquiries "In Process" answers, then Success
+//   - fail_after: Inquiries "In Process" answers, then Fail with ResponseMsg
+//   - unavailable: every endpoint answers 503
+type Rule struct {
+	Name            string      `json:"name"`
+	MerchantTransID string      `json:"merchantTransID,omitempty"`
+	Account         string      `json:"account,omitempty"`
+	MinAmount       *eft.Amount `json:"minAmount,omitempty"`
+	MaxAmount       *eft.Amount `json:"maxAmount,omitempty"`
+	Outcome         string      `json:"outcome,omitempty"`
+	ResponseCode    string      `json:"responseCode,omitempty"`
+	ResponseMsg     string      `json:"responseMsg,omitempty"`
+	Inquiries       int         `json:"inquiries,omitempty"`
+	Scenario        *Scenario   `json:"scenario,omitempty"`
+}
+
+func (r Rule) scenario() (Scenario, error) {
+	if r.Scenario != nil {
+		return *r.Scenario, nil
+	}
+	inProcess := make([]Step, r.Inquiries, r.Inquiries+1)
+	for i := range inProcess {
+		inProcess[i] = Step{TxnStatus: eft.TxnStatusInProcess}
+	}
+	switch r.Outcome {
+	case "", OutcomeSuccess:
+		return Scenario{}, nil
+	case OutcomeReject:
+		return Scenario{Verify: []Step{{ResponseCode: r.ResponseCode, ResponseMsg: r.ResponseMsg}}}, nil
+	case OutcomeDelayedSuccess:
+		return Scenario{Inquiry: append(inProcess, Step{})}, nil
+	case OutcomeFailAfter:
+		return Scenario{Inquiry: append(inProcess, Step{TxnStatus: eft.TxnStatusFail, FailMsg: r.ResponseMsg})}, nil
+	case OutcomeUnavailable:
+		unavailable := []Step{{Status: http.StatusServiceUnavailable}}
+		return Scenario{Verify: unavailable, Transfer: unavailable, Inquiry: unavailable}, nil
+	}
+	return Scenario{}, fmt.Errorf("rule %q: unknown outcome %q", r.Name, r.Outcome)
+}
+
+type compiledRule struct {
+	rule            Rule
+	merchantTransID *regexp.Regexp
+	account         *regexp.Regexp
+	scenario        Scenario
+}
+
+func (c compiledRule) matches(req eft.VerifyDataFundTransferRequest) bool {
+	if c.merchantTransID != nil && !c.merchantTransID.MatchString(req.MerchantTransID) {
+		return false
+	}
+	if c.account != nil && !c.account.MatchString(req.ProxyValue) && !c.account.MatchString(req.FromAccountNo) {
+		return false
+	}
+	if c.rule.MinAmount != nil && req.Amount.LessThan(c.rule.MinAmount.Decimal) {
+		return false
+	}
+	if c.rule.MaxAmount != nil && req.Amount.GreaterThan(c.rule.MaxAmount.Decimal) {
+		return false
+	}
+	return true
+}
+
+// MatchRules returns a ScenarioFunc using the first matching rule.
+func MatchRules(rules []Rule) (ScenarioFunc, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledRule{rule: rule}
+		var err error
+		if rule.MerchantTransID != "" {
+			if c.merchantTransID, err = regexp.Compile(rule.MerchantTransID); err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+		}
+		if rule.Account != "" {
+			if c.account, err = regexp.Compile(rule.Account); err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+		}
+		if c.scenario, err = rule.scenario(); err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, c)
+	}
+	return func(req eft.VerifyDataFundTransferRequest) (Scenario, bool) {
+		for _, c := range compiled {
+			if c.matches(req) {
+				return c.scenario, true
+			}
+		}
+		return Scenario{}, false
+	}, nil
+}
+
+// FromToggle builds the mock bank behind config.ToggleConfiguration. Script
+// is a path to a Script file; without one, Case "F" fails every call with
+// 503 and anything else succeeds.
+func FromToggle(toggle config.ToggleConfiguration) (*Server, error) {
+	if toggle.Script != "" {
+		data, err := os.ReadFile(toggle.Script)
+		if err != nil {
+			return nil, fmt.Errorf("read mock bank script: %w", err)
+		}
+		return NewFromScript(data)
+	}
+	if toggle.Case == "F" {
+		unavailable := []Step{{Status: http.StatusServiceUnavailable}}
+		return New(Scenario{OAuth: unavailable, Verify: unavailable, Transfer: unavailable, Inquiry: unavailable}), nil
+	}
+	return New(Scenario{}), nil
+}
+
+// Client serves requests in-process, without a listener, so UAT and tests
+// exercise the eft HTTP code paths against the mock bank.
+func (s *Server) Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: handlerTransport{handler: s}}
+}
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t.handler.ServeHTTP(recorder, req)
+	}()
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-done:
+	}
+	res := recorder.Result()
+	res.Request = req
+	return res, nil
+}
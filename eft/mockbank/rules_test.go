@@ -0,0 +1,44 @@
+package mockbank
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+)
+
+func TestMatchRules(t *testing.T) {
+	server, err := NewFromScript([]byte(`{
+		"rules": [
+			{"name": "closed account", "account": "^999", "outcome": "reject", "responseCode": "1002", "responseMsg": "Account closed"},
+			{"name": "large", "minAmount": "50000", "outcome": "delayed_success", "inquiries": 2},
+			{"name": "flaky", "merchantTransID": "^FAIL-", "outcome": "fail_after", "inquiries": 1, "responseMsg": "Rejected by receiving bank"}
+		]
+	}`))
+	assert.Equal(t, nil, err)
+
+	request := func(merchantTransID, account, amount string) eft.VerifyDataFundTransferRequest {
+		return eft.VerifyDataFundTransferRequest{MerchantTransID: merchantTransID, ProxyValue: account, Amount: eft.MustAmount(amount)}
+	}
+	tests := []struct {
+		name string
+		req  eft.VerifyDataFundTransferRequest
+		want Scenario
+		ok   bool
+	}{
+		{name: "account", req: request("T1", "9991234", "10"), want: Scenario{Verify: []Step{{ResponseCode: "1002", ResponseMsg: "Account closed"}}}, ok: true},
+		{name: "amount", req: request("T2", "1234", "50000.00"), want: Scenario{Inquiry: []Step{{TxnStatus: eft.TxnStatusInProcess}, {TxnStatus: eft.TxnStatusInProcess}, {}}}, ok: true},
+		{name: "pattern", req: request("FAIL-1", "1234", "10"), want: Scenario{Inquiry: []Step{{TxnStatus: eft.TxnStatusInProcess}, {TxnStatus: eft.TxnStatusFail, FailMsg: "Rejected by receiving bank"}}}, ok: true},
+		{name: "no rule", req: request("T3", "1234", "10"), want: Scenario{}, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario, ok := server.match(tt.req)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, scenario)
+		})
+	}
+
+	_, err = MatchRules([]Rule{{Name: "typo", Outcome: "sucess"}})
+	assert.EqualError(t, err, `rule "typo": unknown outcome "sucess"`)
+}
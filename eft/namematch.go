@@ -0,0 +1,162 @@
+package eft
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+// namePrefixes are titles dropped before comparing names, longest first so
+// that "นางสาว" is not cut down to "สาว" by "นาง".
+var namePrefixes = []string{
+	"นางสาว", "น.ส.", "นาย", "นาง", "ด.ช.", "ด.ญ.", "บริษัท",
+	"MISS ", "MRS.", "MRS ", "MR.", "MR ", "MS.", "MS ",
+}
+
+var nameSuffixes = []string{"จำกัด (มหาชน)", "จำกัด", "CO., LTD.", "CO.,LTD.", "PUBLIC COMPANY LIMITED", "COMPANY LIMITED", "LTD."}
+
+// NormalizeName upper-cases, drops titles and company suffixes, and keeps
+// only letters, digits and single spaces.
+func NormalizeName(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for _, prefix := range namePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			name = strings.TrimSpace(strings.TrimPrefix(name, prefix))
+			break
+		}
+	}
+	for _, suffix := range nameSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSpace(strings.TrimSuffix(name, suffix))
+			break
+		}
+	}
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			b.WriteRune(r)
+			space = false
+		case !space && b.Len() > 0:
+			b.WriteRune(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// NameSimilarity is 1 minus the edit distance between the normalized names
+// over the longer one's length, so 1 is identical and 0 shares nothing.
+func NameSimilarity(a, b string) float64 {
+	ra, rb := []rune(NormalizeName(a)), []rune(NormalizeName(b))
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+type NameMatch struct {
+	Matched    bool
+	Similarity float64
+	// Name is the account name the best similarity was found against.
+	Name string
+}
+
+// MatchAccountName compares the expected beneficiary with both the Thai and
+// English account names the bank returned and keeps the closer one.
+func MatchAccountName(expected string, response *VerifyDataFundTransferResponse, threshold float64) NameMatch {
+	var best NameMatch
+	for _, name := range []string{response.ToAccNameTH, response.ToAccNameEN} {
+		if name == "" {
+			continue
+		}
+		if similarity := NameSimilarity(expected, name); similarity > best.Similarity || best.Name == "" {
+			best = NameMatch{Similarity: similarity, Name: name}
+		}
+	}
+	best.Matched = best.Name != "" && best.Similarity >= threshold
+	return best
+}
+
+type PayeeVerification struct {
+	Response  *VerifyDataFundTransferResponse
+	NameMatch NameMatch
+}
+
+// VerifyPayeeFunc looks up a payee ahead of paying out. A non-success
+// responseCode is returned as its GatewayError along with the response.
+type VerifyPayeeFunc func(ctx context.Context, logger *zap.Logger, req VerifyDataFundTransferRequest, expectedName string) (*PayeeVerification, error)
+
+func VerifyPayee(
+	cfg config.EFTConfig,
+	GetAccessTokenFunc GetAccessTokenFunc,
+	InvalidateAccessTokenFunc InvalidateAccessTokenFunc,
+	HTTPVerifyDataFundTransferFunc HTTPVerifyDataFundTransferFunc,
+) VerifyPayeeFunc {
+	return func(ctx context.Context, logger *zap.Logger, req VerifyDataFundTransferRequest, expectedName string) (*PayeeVerification, error) {
+		if req.MerchantID == "" {
+			req.MerchantID = cfg.MerchantID
+		}
+		var response *VerifyDataFundTransferResponse
+		err := callWithToken(ctx, logger, GetAccessTokenFunc, InvalidateAccessTokenFunc, func(accessToken string) (err error) {
+			response, err = HTTPVerifyDataFundTransferFunc(ctx, logger, req, accessToken)
+			return err
+		})
+		if err != nil {
+			logger.Error("Error HTTPVerifyDataFundTransferFunc", zap.Error(err))
+			return nil, err
+		}
+
+		verification := &PayeeVerification{Response: response}
+		if err := response.Err(); err != nil {
+			return verification, err
+		}
+		if expectedName != "" {
+			verification.NameMatch = MatchAccountName(expectedName, response, cfg.NameMatchThreshold)
+			logger.Info("payee name match",
+				zap.String("merchantTransID", req.MerchantTransID),
+				zap.Bool("matched", verification.NameMatch.Matched),
+				zap.Float64("similarity", verification.NameMatch.Similarity),
+			)
+		}
+		return verification, nil
+	}
+}
@@ -0,0 +1,31 @@
+package eft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchAccountName(t *testing.T) {
+	response := &VerifyDataFundTransferResponse{ToAccNameTH: "นางสาว สมหญิง ใจดี", ToAccNameEN: "MISS SOMYING JAIDEE"}
+
+	tests := []struct {
+		name     string
+		expected string
+		matched  bool
+	}{
+		{name: "thai without title", expected: "สมหญิง ใจดี", matched: true},
+		{name: "english case and title", expected: "Ms. Somying Jaidee", matched: true},
+		{name: "one typo", expected: "SOMYING JAIDE", matched: true},
+		{name: "different person", expected: "SOMCHAI RAKDEE", matched: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := MatchAccountName(tt.expected, response, 0.85)
+			assert.Equal(t, tt.matched, match.Matched, "similarity %.2f against %s", match.Similarity, match.Name)
+		})
+	}
+
+	assert.Equal(t, "SOMYING JAIDEE", NormalizeName("  Mrs.  Somying   Jaidee "))
+	assert.Equal(t, float64(0), NameSimilarity("", ""))
+}
@@ -0,0 +1,238 @@
+package eft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/kafka"
+	"go.uber.org/zap"
+)
+
+// TransferEventVersion is bumped on any incompatible change to TransferEvent.
+const TransferEventVersion = 1
+
+// outboxLockKey serializes relays through pg_try_advisory_xact_lock, so
+// events leave in outbox order even with several relays running.
+const outboxLockKey = 7_310_048
+
+// eventStates are the transitions published as lifecycle events.
+var eventStates = map[string]bool{StateSubmitted: true, StateSuccess: true, StateFailed: true, StateUnknown: true}
+
+// TransferEvent is one fund transfer state change, keyed by MerchantTransID
+// on Kafka. It carries no account numbers or tax IDs.
+type TransferEvent struct {
+	EventID         string    `json:"eventID"`
+	Version         int       `json:"version"`
+	Type            string    `json:"type"`
+	MerchantTransID string    `json:"merchantTransID"`
+	MerchantID      string    `json:"merchantID"`
+	RsTransID       string    `json:"rsTransID,omitempty"`
+	From            string    `json:"from"`
+	Status          string    `json:"status"`
+	Amount          *Amount   `json:"amount,omitempty"`
+	ToBankCode      string    `json:"toBankCode,omitempty"`
+	SettlementDate  string    `json:"settlementDate,omitempty"`
+	FailMsg         string    `json:"failMsg,omitempty"`
+	OccurredAt      time.Time `json:"occurredAt"`
+}
+
+// TransferEventType is e.g. fund_transfer.success for SUCCESS.
+func TransferEventType(status string) string {
+	return "fund_transfer." + strings.ToLower(status)
+}
+
+// insertOutboxEvent queues the event for a transition inside the caller's
+// transaction, after the fund_transfer row has been updated. Repeated
+// SUBMITTED or UNKNOWN answers are not a state change and queue nothing.
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, merchantTransID, from, to string) error {
+	if from == to || !eventStates[to] {
+		return nil
+	}
+	event := TransferEvent{
+		EventID:         uuid.NewString(),
+		Version:         TransferEventVersion,
+		Type:            TransferEventType(to),
+		MerchantTransID: merchantTransID,
+		From:            from,
+		Status:          to,
+		OccurredAt:      time.Now(),
+	}
+	var amount *string
+	sql := `select merchant_id, coalesce(rs_trans_id, ''), amount::text, coalesce(to_bank_code, ''),
+			coalesce(settlement_date, ''), coalesce(fail_msg, '')
+			from fund_transfer where merchant_trans_id = $1`
+	err := tx.QueryRow(ctx, sql, merchantTransID).Scan(
+		&event.MerchantID,
+		&event.RsTransID,
+		&amount,
+		&event.ToBankCode,
+		&event.SettlementDate,
+		&event.FailMsg,
+	)
+	if err != nil {
+		return err
+	}
+	if amount != nil {
+		value, err := NewAmount(*amount)
+		if err != nil {
+			return err
+		}
+		event.Amount = &value
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	sql = `insert into fund_transfer_outbox (event_id, merchant_trans_id, event_type, version, payload) values ($1, $2, $3, $4, $5)`
+	_, err = tx.Exec(ctx, sql, event.EventID, merchantTransID, event.Type, event.Version, payload)
+	return err
+}
+
+type PublishTransferEventFunc func(ctx context.Context, logger *zap.Logger, event TransferEvent) error
+
+func PublishTransferEventToKafka(send kafka.SendMessageSyncWithKeyFunc, topic string) PublishTransferEventFunc {
+	return func(ctx context.Context, logger *zap.Logger, event TransferEvent) error {
+		return send(logger, event.MerchantTransID, event, topic)
+	}
+}
+
+type RelayReport struct {
+	Published int
+	Failed    int
+	Parked    int
+	// Skipped is set when another relay held the outbox lock.
+	Skipped bool
+}
+
+type RelayOutboxFunc func(ctx context.Context, logger *zap.Logger) (*RelayReport, error)
+
+// RelayOutbox publishes up to cfg.Batch unpublished events in outbox order,
+// one per transaction, so the outbox lock is held for a single send at a
+// time. A failed event stops the run so a transfer's later events never
+// overtake it, and is retried on the next run. After cfg.MaxAttempts it is
+// parked, setting parked_at, and the relay moves on; the transfer's later
+// events wait until an operator clears parked_at to replay it. Delivery is at
+// least once, and consumers dedupe on EventID.
+func RelayOutbox(db *pgxpool.Pool, cfg config.OutboxConfig, PublishTransferEventFunc PublishTransferEventFunc) RelayOutboxFunc {
+	return relayOutbox(db.Begin, cfg, PublishTransferEventFunc)
+}
+
+func relayOutbox(begin func(ctx context.Context) (pgx.Tx, error), cfg config.OutboxConfig, PublishTransferEventFunc PublishTransferEventFunc) RelayOutboxFunc {
+	return func(ctx context.Context, logger *zap.Logger) (*RelayReport, error) {
+		report := &RelayReport{}
+		for n := 0; n < cfg.Batch; n++ {
+			more, err := relayOutboxEvent(ctx, logger, begin, cfg, PublishTransferEventFunc, report)
+			if err != nil {
+				return nil, err
+			}
+			if !more {
+				break
+			}
+		}
+		logger.Info("outbox relayed", zap.Int("published", report.Published), zap.Int("failed", report.Failed), zap.Int("parked", report.Parked))
+		return report, nil
+	}
+}
+
+// relayOutboxEvent publishes the oldest relayable event in a transaction of
+// its own and reports whether the relay should go on to the next one.
+func relayOutboxEvent(
+	ctx context.Context,
+	logger *zap.Logger,
+	begin func(ctx context.Context) (pgx.Tx, error),
+	cfg config.OutboxConfig,
+	PublishTransferEventFunc PublishTransferEventFunc,
+	report *RelayReport,
+) (bool, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func(tx pgx.Tx) {
+		_ = tx.Rollback(ctx)
+	}(tx)
+
+	var locked bool
+	if err = tx.QueryRow(ctx, `select pg_try_advisory_xact_lock($1)`, outboxLockKey).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		report.Skipped = true
+		logger.Info("outbox relay busy elsewhere")
+		return false, nil
+	}
+
+	sql := `select o.id, o.attempts, o.payload from fund_transfer_outbox o
+			where o.published_at is null
+			  and o.parked_at is null
+			  and not exists (select 1 from fund_transfer_outbox p
+							  where p.merchant_trans_id = o.merchant_trans_id
+							    and p.parked_at is not null
+							    and p.published_at is null
+							    and p.id < o.id)
+			order by o.id
+			limit 1`
+	var id int64
+	var attempts int
+	var payload []byte
+	err = tx.QueryRow(ctx, sql).Scan(&id, &attempts, &payload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var event TransferEvent
+	err = json.Unmarshal(payload, &event)
+	if err == nil {
+		err = PublishTransferEventFunc(ctx, logger, event)
+	}
+	if err == nil {
+		sql = `update fund_transfer_outbox set published_at = now(), attempts = attempts + 1, last_error = null where id = $1`
+		if _, err := tx.Exec(ctx, sql, id); err != nil {
+			return false, err
+		}
+		report.Published++
+		return true, tx.Commit(ctx)
+	}
+
+	log := logger.With(zap.Int64("id", id), zap.String("merchantTransID", event.MerchantTransID), zap.Int("attempts", attempts+1))
+	parked := cfg.MaxAttempts > 0 && attempts+1 >= cfg.MaxAttempts
+	if parked {
+		log.Error("outbox event parked", zap.Error(err))
+		report.Parked++
+	} else {
+		log.Error("Error PublishTransferEventFunc", zap.Error(err))
+		report.Failed++
+	}
+	sql = `update fund_transfer_outbox
+			set attempts   = attempts + 1,
+				last_error = $2,
+				parked_at  = case when $3 then now() end
+			where id = $1`
+	if _, err := tx.Exec(ctx, sql, id, err.Error(), parked); err != nil {
+		return false, err
+	}
+	return parked, tx.Commit(ctx)
+}
+
+// RunOutboxRelay relays every interval until ctx is done.
+func RunOutboxRelay(ctx context.Context, logger *zap.Logger, interval time.Duration, RelayOutboxFunc RelayOutboxFunc) error {
+	for {
+		if _, err := RelayOutboxFunc(ctx, logger); err != nil && ctx.Err() == nil {
+			logger.Error("Error RelayOutboxFunc", zap.Error(err))
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package eft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+type outboxRow struct {
+	id              int64
+	merchantTransID string
+	attempts        int
+	payload         []byte
+	published       bool
+	parked          bool
+	lastError       string
+}
+
+// fakeOutbox answers the statements outbox.go sends; changes made in a
+// transaction only land on Commit.
+type fakeOutbox struct {
+	busy    bool
+	rows    []*outboxRow
+	commits int
+}
+
+type fakeOutboxTx struct {
+	pgx.Tx
+	outbox  *fakeOutbox
+	pending []func()
+}
+
+type fakeRow func(dest ...interface{}) error
+
+func (r fakeRow) Scan(dest ...interface{}) error { return r(dest...) }
+
+func (o *fakeOutbox) begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeOutboxTx{outbox: o}, nil
+}
+
+func (o *fakeOutbox) add(merchantTransID, status string) {
+	payload, _ := json.Marshal(TransferEvent{EventID: status, MerchantTransID: merchantTransID, Status: status})
+	o.rows = append(o.rows, &outboxRow{id: int64(len(o.rows) + 1), merchantTransID: merchantTransID, payload: payload})
+}
+
+func (tx *fakeOutboxTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	switch {
+	case strings.Contains(sql, "pg_try_advisory_xact_lock"):
+		return fakeRow(func(dest ...interface{}) error {
+			*dest[0].(*bool) = !tx.outbox.busy
+			return nil
+		})
+	case strings.Contains(sql, "from fund_transfer_outbox o"):
+		held := map[string]bool{}
+		for _, row := range tx.outbox.rows {
+			if row.published {
+				continue
+			}
+			if row.parked {
+				held[row.merchantTransID] = true
+				continue
+			}
+			if held[row.merchantTransID] {
+				continue
+			}
+			row := row
+			return fakeRow(func(dest ...interface{}) error {
+				*dest[0].(*int64), *dest[1].(*int), *dest[2].(*[]byte) = row.id, row.attempts, row.payload
+				return nil
+			})
+		}
+		return fakeRow(func(dest ...interface{}) error { return pgx.ErrNoRows })
+	case strings.Contains(sql, "from fund_transfer where"):
+		return fakeRow(func(dest ...interface{}) error {
+			amount := "100.50"
+			*dest[0].(*string), *dest[1].(*string), *dest[2].(**string) = "M1", "RS1", &amount
+			*dest[3].(*string), *dest[4].(*string), *dest[5].(*string) = "004", "20261019", ""
+			return nil
+		})
+	}
+	panic("unexpected query: " + sql)
+}
+
+func (tx *fakeOutboxTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	outbox := tx.outbox
+	find := func(id interface{}) *outboxRow { return outbox.rows[id.(int64)-1] }
+	switch {
+	case strings.HasPrefix(sql, "insert into fund_transfer_outbox"):
+		tx.pending = append(tx.pending, func() {
+			outbox.rows = append(outbox.rows, &outboxRow{id: int64(len(outbox.rows) + 1), merchantTransID: args[1].(string), payload: args[4].([]byte)})
+		})
+	case strings.Contains(sql, "set published_at = now()"):
+		row := find(args[0])
+		tx.pending = append(tx.pending, func() { row.published, row.attempts = true, row.attempts+1 })
+	case strings.Contains(sql, "parked_at"):
+		row := find(args[0])
+		tx.pending = append(tx.pending, func() {
+			row.attempts, row.lastError, row.parked = row.attempts+1, args[1].(string), args[2].(bool)
+		})
+	default:
+		panic("unexpected statement: " + sql)
+	}
+	return pgconn.NewCommandTag("OK"), nil
+}
+
+func (tx *fakeOutboxTx) Commit(ctx context.Context) error {
+	for _, apply := range tx.pending {
+		apply()
+	}
+	tx.pending = nil
+	tx.outbox.commits++
+	return nil
+}
+
+func (tx *fakeOutboxTx) Rollback(ctx context.Context) error {
+	tx.pending = nil
+	return nil
+}
+
+func TestInsertOutboxEvent(t *testing.T) {
+	tests := []struct {
+		from, to string
+		queued   bool
+	}{
+		{from: StateVerified, to: StateSubmitted, queued: true},
+		{from: StateSubmitted, to: StateSuccess, queued: true},
+		{from: StateSubmitted, to: StateSubmitted},
+		{from: StateUnknown, to: StateUnknown},
+		{from: StateInitiated, to: StateVerified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			outbox := &fakeOutbox{}
+			tx, _ := outbox.begin(context.Background())
+			assert.Equal(t, nil, insertOutboxEvent(context.Background(), tx, "T1", tt.from, tt.to))
+			assert.Equal(t, nil, tx.Commit(context.Background()))
+			assert.Equal(t, tt.queued, len(outbox.rows) == 1)
+			if !tt.queued {
+				return
+			}
+
+			var event TransferEvent
+			assert.Equal(t, nil, json.Unmarshal(outbox.rows[0].payload, &event))
+			assert.Equal(t, "T1", outbox.rows[0].merchantTransID)
+			assert.Equal(t, TransferEventType(tt.to), event.Type)
+			assert.Equal(t, TransferEventVersion, event.Version)
+			assert.Equal(t, tt.from, event.From)
+			assert.Equal(t, tt.to, event.Status)
+			assert.Equal(t, "M1", event.MerchantID)
+			assert.Equal(t, "RS1", event.RsTransID)
+			assert.Equal(t, "100.50", event.Amount.String())
+			assert.NotEqual(t, "", event.EventID)
+		})
+	}
+}
+
+func TestRelayOutbox(t *testing.T) {
+	outbox := &fakeOutbox{}
+	outbox.add("T1", StateSubmitted)
+	outbox.add("T2", StateSubmitted)
+	outbox.add("T1", StateSuccess)
+
+	var sent []string
+	publish := func(ctx context.Context, logger *zap.Logger, event TransferEvent) error {
+		if event.MerchantTransID == "T2" {
+			return errors.New("message too large")
+		}
+		sent = append(sent, event.MerchantTransID+" "+event.Status)
+		return nil
+	}
+	relay := relayOutbox(outbox.begin, config.OutboxConfig{Batch: 10, MaxAttempts: 2}, publish)
+
+	// T2 fails, and the run stops so nothing overtakes it.
+	report, err := relay(context.Background(), zap.NewNop())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RelayReport{Published: 1, Failed: 1}, *report)
+	assert.Equal(t, []string{"T1 SUBMITTED"}, sent)
+	assert.Equal(t, 2, outbox.commits)
+
+	// Its last attempt parks it, and the relay moves past it.
+	report, err = relay(context.Background(), zap.NewNop())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RelayReport{Published: 1, Parked: 1}, *report)
+	assert.Equal(t, []string{"T1 SUBMITTED", "T1 SUCCESS"}, sent)
+	assert.Equal(t, true, outbox.rows[1].parked)
+	assert.Equal(t, 2, outbox.rows[1].attempts)
+	assert.Equal(t, "message too large", outbox.rows[1].lastError)
+
+	// T2's later events wait behind the parked one; other transfers go on.
+	outbox.add("T2", StateSuccess)
+	outbox.add("T3", StateSubmitted)
+	report, err = relay(context.Background(), zap.NewNop())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RelayReport{Published: 1}, *report)
+	assert.Equal(t, []string{"T1 SUBMITTED", "T1 SUCCESS", "T3 SUBMITTED"}, sent)
+	assert.Equal(t, false, outbox.rows[3].published)
+
+	outbox.add("T4", StateSubmitted)
+	outbox.busy = true
+	report, err = relay(context.Background(), zap.NewNop())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RelayReport{Skipped: true}, *report)
+}
+
+func TestRelayOutboxBatch(t *testing.T) {
+	outbox := &fakeOutbox{}
+	for i := 0; i < 5; i++ {
+		outbox.add("T1", StateSubmitted)
+	}
+	publish := func(ctx context.Context, logger *zap.Logger, event TransferEvent) error { return nil }
+
+	// Each event is committed on its own, so the lock spans one send.
+	report, err := relayOutbox(outbox.begin, config.OutboxConfig{Batch: 3}, publish)(context.Background(), zap.NewNop())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, report.Published)
+	assert.Equal(t, 3, outbox.commits)
+}
@@ -0,0 +1,531 @@
+package eft
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/sftp"
+	"go.uber.org/zap"
+)
+
+// Payout line states on top of the fund transfer states. A PENDING line has
+// not reached the bank yet and is picked up again by the next run.
+const (
+	PayoutPending = "PENDING"
+	PayoutInvalid = "INVALID"
+)
+
+// ErrPayoutIncomplete is returned when a run ends with lines still PENDING.
+var ErrPayoutIncomplete = errors.New("payout batch has pending lines")
+
+// payoutColumns are required in an instruction file; fromAccountNo,
+// senderName, senderTaxID, transType and typeOfSender are optional.
+var payoutColumns = []string{"merchanttransid", "proxytype", "proxyvalue", "tobankcode", "amount"}
+
+// PayoutLine is one payout instruction and its outcome.
+type PayoutLine struct {
+	BatchID string
+	Line    int
+	VerifyDataFundTransferRequest
+	Status         string
+	RsTransID      string
+	SettlementDate string
+	FailMsg        string
+}
+
+type PayoutReport struct {
+	BatchID   string
+	Lines     []PayoutLine
+	Processed int
+	Skipped   int
+	Counts    map[string]int
+}
+
+// ParsePayoutFile reads a delimited instruction file with a header row.
+// Columns are found by name, case-insensitively. Lines that fail validation
+// are returned as INVALID rather than failing the whole file.
+func ParsePayoutFile(data []byte, delimiter rune, batchID string) ([]PayoutLine, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("payout header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range payoutColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("payout header has no %s column", name)
+		}
+	}
+
+	var lines []PayoutLine
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return ValidatePayoutLines(lines), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("payout line %d: %w", line, err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		payout := PayoutLine{
+			BatchID: batchID,
+			Line:    line,
+			VerifyDataFundTransferRequest: VerifyDataFundTransferRequest{
+				MerchantTransID: field("merchanttransid"),
+				ProxyType:       field("proxytype"),
+				ProxyValue:      field("proxyvalue"),
+				FromAccountNo:   field("fromaccountno"),
+				TransType:       field("transtype"),
+				SenderName:      field("sendername"),
+				SenderTaxID:     field("sendertaxid"),
+				ToBankCode:      field("tobankcode"),
+				TypeOfSender:    field("typeofsender"),
+			},
+			Status: PayoutPending,
+		}
+		if payout.Amount, err = NewAmount(field("amount")); err != nil {
+			payout.Status, payout.FailMsg = PayoutInvalid, fmt.Sprintf("invalid amount %q", field("amount"))
+		}
+		lines = append(lines, payout)
+	}
+}
+
+// ValidatePayoutLines marks PENDING lines with a missing field, a bad amount
+// or a repeated merchantTransID as INVALID. Only the first line of a repeated
+// merchantTransID is paid.
+func ValidatePayoutLines(lines []PayoutLine) []PayoutLine {
+	seen := map[string]int{}
+	for i := range lines {
+		line := &lines[i]
+		if line.Status != PayoutPending {
+			continue
+		}
+		var msg string
+		switch {
+		case line.MerchantTransID == "":
+			msg = "merchantTransID is required"
+		case line.ProxyType == "" || line.ProxyValue == "":
+			msg = "proxyType and proxyValue are required"
+		case line.ToBankCode == "":
+			msg = "toBankCode is required"
+		}
+		if msg == "" {
+			if err := line.Amount.Validate(); err != nil {
+				msg = err.Error()
+			}
+		}
+		if msg == "" {
+			if first, ok := seen[line.MerchantTransID]; ok {
+				msg = fmt.Sprintf("duplicate merchantTransID, first on line %d", first)
+			} else {
+				seen[line.MerchantTransID] = line.Line
+			}
+		}
+		if msg != "" {
+			line.Status, line.FailMsg = PayoutInvalid, msg
+		}
+	}
+	return lines
+}
+
+// PayoutResultKey is where the result file for an instruction file goes:
+// payout/20240101.csv gives payout/20240101_result.csv.
+func PayoutResultKey(file string) string {
+	return strings.TrimSuffix(file, path.Ext(file)) + "_result.csv"
+}
+
+// PayoutBatchID is cfg.BatchID or, when unset, the instruction file's base
+// name without its extension.
+func PayoutBatchID(cfg config.PayoutConfig) string {
+	if cfg.BatchID != "" {
+		return cfg.BatchID
+	}
+	base := path.Base(cfg.File)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+func payoutDelimiter(cfg config.PayoutConfig) rune {
+	if cfg.Delimiter != "" {
+		return []rune(cfg.Delimiter)[0]
+	}
+	return ','
+}
+
+type GetPayoutInstructionsFunc func(ctx context.Context, logger *zap.Logger, batchID string) ([]PayoutLine, error)
+
+func GetPayoutFileFromS3(svc *s3.S3, bucket string, cfg config.PayoutConfig) GetPayoutInstructionsFunc {
+	return func(ctx context.Context, logger *zap.Logger, batchID string) ([]PayoutLine, error) {
+		output, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: &bucket,
+			Key:    &cfg.File,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("get payout file %s: %w", cfg.File, err)
+		}
+		defer output.Body.Close()
+		data, err := io.ReadAll(output.Body)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("payout file downloaded", zap.String("key", cfg.File), zap.Int("size", len(data)))
+		return ParsePayoutFile(data, payoutDelimiter(cfg), batchID)
+	}
+}
+
+func DownloadPayoutFile(client *sftp.Client, cfg config.PayoutConfig) GetPayoutInstructionsFunc {
+	return func(ctx context.Context, logger *zap.Logger, batchID string) ([]PayoutLine, error) {
+		data, err := client.Download(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("download payout file %s: %w", cfg.File, err)
+		}
+		logger.Info("payout file downloaded", zap.String("path", cfg.File), zap.Int("size", len(data)))
+		return ParsePayoutFile(data, payoutDelimiter(cfg), batchID)
+	}
+}
+
+// ListPayoutInstructions reads the batch from payout_instruction, where
+// line_no orders the lines like a file would.
+func ListPayoutInstructions(db *pgxpool.Pool) GetPayoutInstructionsFunc {
+	return func(ctx context.Context, logger *zap.Logger, batchID string) ([]PayoutLine, error) {
+		sql := `select line_no, merchant_trans_id, proxy_type, proxy_value, coalesce(from_account_no, ''), coalesce(trans_type, ''),
+				coalesce(sender_name, ''), coalesce(sender_tax_id, ''), to_bank_code, amount::text, coalesce(type_of_sender, '')
+				from payout_instruction
+				where batch_id = $1
+				order by line_no`
+		rows, err := db.Query(ctx, sql, batchID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var lines []PayoutLine
+		for rows.Next() {
+			line := PayoutLine{BatchID: batchID, Status: PayoutPending}
+			err := rows.Scan(
+				&line.Line,
+				&line.MerchantTransID,
+				&line.ProxyType,
+				&line.ProxyValue,
+				&line.FromAccountNo,
+				&line.TransType,
+				&line.SenderName,
+				&line.SenderTaxID,
+				&line.ToBankCode,
+				&line.Amount,
+				&line.TypeOfSender,
+			)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		logger.Info("payout instructions loaded", zap.Int("lines", len(lines)))
+		return ValidatePayoutLines(lines), nil
+	}
+}
+
+// ListPayoutLineStatusFunc returns the saved status of each line of a batch,
+// keyed by line number.
+type ListPayoutLineStatusFunc func(ctx context.Context, logger *zap.Logger, batchID string) (map[int]PayoutLine, error)
+
+func ListPayoutLineStatus(db *pgxpool.Pool) ListPayoutLineStatusFunc {
+	return func(ctx context.Context, logger *zap.Logger, batchID string) (map[int]PayoutLine, error) {
+		sql := `select line_no, merchant_trans_id, status, coalesce(rs_trans_id, ''), coalesce(settlement_date, ''), coalesce(fail_msg, '')
+				from payout_line
+				where batch_id = $1`
+		rows, err := db.Query(ctx, sql, batchID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		saved := map[int]PayoutLine{}
+		for rows.Next() {
+			line := PayoutLine{BatchID: batchID}
+			if err := rows.Scan(&line.Line, &line.MerchantTransID, &line.Status, &line.RsTransID, &line.SettlementDate, &line.FailMsg); err != nil {
+				return nil, err
+			}
+			saved[line.Line] = line
+		}
+		return saved, rows.Err()
+	}
+}
+
+type SavePayoutLineFunc func(ctx context.Context, logger *zap.Logger, line PayoutLine) error
+
+func SavePayoutLine(db *pgxpool.Pool) SavePayoutLineFunc {
+	return func(ctx context.Context, logger *zap.Logger, line PayoutLine) error {
+		sql := `insert into payout_line (batch_id, line_no, merchant_trans_id, amount, status, rs_trans_id, settlement_date, fail_msg)
+				values ($1, $2, $3, $4::numeric, $5, nullif($6, ''), nullif($7, ''), nullif($8, ''))
+				on conflict (batch_id, line_no) do update
+				set status = excluded.status,
+				    rs_trans_id = excluded.rs_trans_id,
+				    settlement_date = excluded.settlement_date,
+				    fail_msg = excluded.fail_msg,
+				    updated_at = now()`
+		var amount *Amount
+		if !line.Amount.IsZero() {
+			amount = &line.Amount
+		}
+		_, err := db.Exec(ctx, sql, line.BatchID, line.Line, line.MerchantTransID, amount, line.Status, line.RsTransID, line.SettlementDate, line.FailMsg)
+		return err
+	}
+}
+
+type PublishPayoutResultFunc func(ctx context.Context, logger *zap.Logger, report PayoutReport) error
+
+// PayoutResultCSV writes one row per instruction line with its final status
+// and bank reference.
+func PayoutResultCSV(report PayoutReport) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{"line", "merchantTransID", "proxyValue", "toBankCode", "amount", "status", "rsTransID", "settlementDate", "failMsg"})
+	for _, line := range report.Lines {
+		amount := ""
+		if !line.Amount.IsZero() {
+			amount = line.Amount.String()
+		}
+		_ = writer.Write([]string{
+			strconv.Itoa(line.Line),
+			line.MerchantTransID,
+			line.ProxyValue,
+			line.ToBankCode,
+			amount,
+			line.Status,
+			line.RsTransID,
+			line.SettlementDate,
+			line.FailMsg,
+		})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func PutPayoutResultToS3(svc *s3.S3, bucket string, cfg config.PayoutConfig) PublishPayoutResultFunc {
+	return func(ctx context.Context, logger *zap.Logger, report PayoutReport) error {
+		body, err := PayoutResultCSV(report)
+		if err != nil {
+			return err
+		}
+		key := PayoutResultKey(cfg.File)
+		_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      &bucket,
+			Key:         &key,
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("text/csv"),
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info("payout result written", zap.String("key", key))
+		return nil
+	}
+}
+
+func UploadPayoutResult(client *sftp.Client, cfg config.PayoutConfig) PublishPayoutResultFunc {
+	return func(ctx context.Context, logger *zap.Logger, report PayoutReport) error {
+		body, err := PayoutResultCSV(report)
+		if err != nil {
+			return err
+		}
+		path := PayoutResultKey(cfg.File)
+		if err := client.Upload(path, body); err != nil {
+			return fmt.Errorf("upload payout result %s: %w", path, err)
+		}
+		logger.Info("payout result uploaded", zap.String("path", path))
+		return nil
+	}
+}
+
+type PayoutFunc func(ctx context.Context, logger *zap.Logger, batchID string) (*PayoutReport, error)
+
+// Payout pays every PENDING line of a batch with at most cfg.Concurrency
+// transfers in flight and cfg.RatePerSecond started per second. Each line is
+// saved as soon as it settles, so a rerun skips lines already paid, failed
+// or handed over to the inquiry poller. A line whose transfer exists from an
+// earlier, interrupted run takes the recorded status instead of paying again;
+// wrapped in IdempotentTransfer, TransferFunc fails one stuck before confirm
+// once it is abandoned, so a later rerun settles the line. A line that cannot
+// be saved after retries stops the run and fails it.
+func Payout(
+	cfg config.PayoutConfig,
+	GetPayoutInstructionsFunc GetPayoutInstructionsFunc,
+	ListPayoutLineStatusFunc ListPayoutLineStatusFunc,
+	TransferFunc TransferFunc,
+	GetFundTransferFunc GetFundTransferFunc,
+	SavePayoutLineFunc SavePayoutLineFunc,
+	PublishPayoutResultFuncs ...PublishPayoutResultFunc,
+) PayoutFunc {
+	return func(ctx context.Context, logger *zap.Logger, batchID string) (*PayoutReport, error) {
+		logger = logger.With(zap.String("batchID", batchID))
+
+		lines, err := GetPayoutInstructionsFunc(ctx, logger, batchID)
+		if err != nil {
+			logger.Error("Error GetPayoutInstructionsFunc", zap.Error(err))
+			return nil, err
+		}
+		saved, err := ListPayoutLineStatusFunc(ctx, logger, batchID)
+		if err != nil {
+			logger.Error("Error ListPayoutLineStatusFunc", zap.Error(err))
+			return nil, err
+		}
+
+		report := &PayoutReport{BatchID: batchID, Lines: lines, Counts: map[string]int{}}
+		var todo []int
+		for i := range lines {
+			line := &lines[i]
+			if previous, ok := saved[line.Line]; ok && previous.Status != PayoutPending {
+				if previous.MerchantTransID != line.MerchantTransID {
+					return nil, fmt.Errorf("payout line %d was %s, now %s", line.Line, previous.MerchantTransID, line.MerchantTransID)
+				}
+				line.Status, line.RsTransID, line.SettlementDate, line.FailMsg = previous.Status, previous.RsTransID, previous.SettlementDate, previous.FailMsg
+				report.Skipped++
+				continue
+			}
+			if line.Status == PayoutInvalid {
+				if err := SavePayoutLineFunc(ctx, logger, *line); err != nil {
+					logger.Error("Error SavePayoutLineFunc", zap.Int("line", line.Line), zap.Error(err))
+					return nil, err
+				}
+				continue
+			}
+			todo = append(todo, i)
+		}
+
+		savePolicy := RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, Multiplier: 2}
+		var saveOnce sync.Once
+		var saveErr error
+		stop := make(chan struct{})
+
+		pay := func(line *PayoutLine) {
+			req := TransferRequest{VerifyDataFundTransferRequest: line.VerifyDataFundTransferRequest}
+			result, err := TransferFunc(ctx, logger, req)
+			if errors.Is(err, ErrDuplicateTransfer) {
+				var record *FundTransferRecord
+				if record, err = GetFundTransferFunc(ctx, logger, line.MerchantTransID); err == nil {
+					result = resultFromRecord(*record)
+				}
+			}
+			if result != nil {
+				line.Status, line.RsTransID, line.SettlementDate, line.FailMsg = result.Status, result.RsTransID, result.SettlementDate, result.FailMsg
+			}
+			if err != nil && result == nil {
+				// Nothing reached the bank; leave the line for the next run.
+				line.FailMsg = err.Error()
+			}
+			if line.Status == StateInitiated || line.Status == StateVerified {
+				line.Status = PayoutPending
+			}
+			err = savePolicy.Do(ctx, logger, func(ctx context.Context, attempt int) error {
+				return SavePayoutLineFunc(ctx, logger, *line)
+			})
+			if err != nil {
+				logger.Error("Error SavePayoutLineFunc", zap.Int("line", line.Line), zap.Error(err))
+				saveOnce.Do(func() {
+					saveErr = fmt.Errorf("save payout line %d: %w", line.Line, err)
+					close(stop)
+				})
+			}
+		}
+
+		interval := time.Second
+		if cfg.RatePerSecond > 0 {
+			interval = time.Duration(float64(time.Second) / cfg.RatePerSecond)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		workers := cfg.Concurrency
+		if workers <= 0 {
+			workers = 1
+		}
+		queue := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range queue {
+					pay(&lines[i])
+				}
+			}()
+		}
+	feed:
+		for n, i := range todo {
+			if n > 0 {
+				select {
+				case <-ctx.Done():
+					break feed
+				case <-stop:
+					break feed
+				case <-ticker.C:
+				}
+			}
+			select {
+			case <-ctx.Done():
+				break feed
+			case <-stop:
+				break feed
+			case queue <- i:
+				report.Processed++
+			}
+		}
+		close(queue)
+		wg.Wait()
+
+		for _, line := range lines {
+			report.Counts[line.Status]++
+		}
+		logger.Info("payout finished",
+			zap.Int("lines", len(lines)),
+			zap.Int("processed", report.Processed),
+			zap.Int("skipped", report.Skipped),
+			zap.Any("counts", report.Counts),
+		)
+
+		// Publish with a fresh context so an interrupted run still leaves a
+		// result file behind.
+		publishCtx := context.Background()
+		for _, publish := range PublishPayoutResultFuncs {
+			if err := publish(publishCtx, logger, *report); err != nil {
+				logger.Error("Error PublishPayoutResultFunc", zap.Error(err))
+				return report, err
+			}
+		}
+		if saveErr != nil {
+			return report, saveErr
+		}
+		if report.Counts[PayoutPending] > 0 {
+			return report, ErrPayoutIncomplete
+		}
+		return report, ctx.Err()
+	}
+}
@@ -0,0 +1,164 @@
+package eft_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft/mockbank"
+	"go.uber.org/zap"
+)
+
+const payoutFile = `merchantTransID,proxyType,proxyValue,toBankCode,amount
+P1,ACCOUNT,1234567890,004,100.00
+P2,ACCOUNT,9990000000,004,200.00
+P3,ACCOUNT,1234567890,004,abc
+P1,ACCOUNT,1234567890,004,100.00
+P4,ACCOUNT,,004,10
+`
+
+type payoutLines struct {
+	mu    sync.Mutex
+	lines map[int]eft.PayoutLine
+}
+
+func (p *payoutLines) list() eft.ListPayoutLineStatusFunc {
+	return func(ctx context.Context, logger *zap.Logger, batchID string) (map[int]eft.PayoutLine, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		saved := map[int]eft.PayoutLine{}
+		for line, payout := range p.lines {
+			saved[line] = payout
+		}
+		return saved, nil
+	}
+}
+
+func (p *payoutLines) save() eft.SavePayoutLineFunc {
+	return func(ctx context.Context, logger *zap.Logger, line eft.PayoutLine) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.lines[line.Line] = line
+		return nil
+	}
+}
+
+func TestPayout(t *testing.T) {
+	bank, err := mockbank.NewFromScript([]byte(`{"rules": [{"name": "closed", "account": "^999", "outcome": "reject", "responseCode": "1002", "responseMsg": "Account closed"}]}`))
+	assert.Equal(t, nil, err)
+	store := &memoryStore{states: map[string][]string{}}
+	transfer, closeBank := newTransfer(bank, store)
+	defer closeBank()
+
+	instructions := func(ctx context.Context, logger *zap.Logger, batchID string) ([]eft.PayoutLine, error) {
+		return eft.ParsePayoutFile([]byte(payoutFile), ',', batchID)
+	}
+	getFundTransfer := func(ctx context.Context, logger *zap.Logger, merchantTransID string) (*eft.FundTransferRecord, error) {
+		return nil, eft.ErrTransferNotFound
+	}
+	saved := &payoutLines{lines: map[int]eft.PayoutLine{}}
+	var result []byte
+	publish := func(ctx context.Context, logger *zap.Logger, report eft.PayoutReport) (err error) {
+		result, err = eft.PayoutResultCSV(report)
+		return err
+	}
+	payout := eft.Payout(
+		config.PayoutConfig{Concurrency: 2, RatePerSecond: 1000},
+		instructions,
+		saved.list(),
+		transfer,
+		getFundTransfer,
+		saved.save(),
+		publish,
+	)
+
+	report, err := payout(context.Background(), zap.NewNop(), "B1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, report.Processed)
+	assert.Equal(t, map[string]int{eft.StateSuccess: 1, eft.StateFailed: 1, eft.PayoutInvalid: 3}, report.Counts)
+	assert.Equal(t, `line,merchantTransID,proxyValue,toBankCode,amount,status,rsTransID,settlementDate,failMsg
+2,P1,1234567890,004,100.00,SUCCESS,RSP1,`+saved.lines[2].SettlementDate+`,
+3,P2,9990000000,004,200.00,FAILED,RSP2,,Account closed
+4,P3,1234567890,004,,INVALID,,,"invalid amount ""abc"""
+5,P1,1234567890,004,100.00,INVALID,,,"duplicate merchantTransID, first on line 2"
+6,P4,,004,10.00,INVALID,,,proxyType and proxyValue are required
+`, string(result))
+
+	// A rerun of the same batch pays nothing again.
+	report, err = payout(context.Background(), zap.NewNop(), "B1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, report.Processed)
+	assert.Equal(t, 5, report.Skipped)
+	assert.Equal(t, 1, bank.Calls(mockbank.PathTransfer))
+}
+
+func TestPayoutStuckLine(t *testing.T) {
+	instructions := func(ctx context.Context, logger *zap.Logger, batchID string) ([]eft.PayoutLine, error) {
+		return eft.ParsePayoutFile([]byte("merchantTransID,proxyType,proxyValue,toBankCode,amount\nP1,ACCOUNT,1234567890,004,100.00\n"), ',', batchID)
+	}
+	cfg := config.EFTConfig{IdempotencyTTL: time.Hour, AbandonAfter: time.Minute}
+
+	tests := []struct {
+		name    string
+		idleFor time.Duration
+		want    string
+		wantErr error
+	}{
+		{name: "first run may still be alive", want: eft.PayoutPending, wantErr: eft.ErrPayoutIncomplete},
+		{name: "abandoned before confirm", idleFor: time.Hour, want: eft.StateFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bank := mockbank.New(mockbank.Scenario{})
+			// An earlier run died between verify and confirm.
+			store := &memoryStore{
+				states:    map[string][]string{"P1": {eft.StateInitiated, eft.StateVerified}},
+				updatedAt: map[string]time.Time{"P1": time.Now().Add(-tt.idleFor)},
+			}
+			pay, closeBank := newTransfer(bank, store)
+			defer closeBank()
+			cmd := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+			transfer := eft.IdempotentTransfer(cmd, cfg, pay, store.get(), eft.ResolveTransfer(cfg, nil, nil, nil, store.transit()))
+			saved := &payoutLines{lines: map[int]eft.PayoutLine{}}
+			payout := eft.Payout(config.PayoutConfig{RatePerSecond: 1000}, instructions, saved.list(), transfer, store.get(), saved.save())
+
+			report, err := payout(context.Background(), zap.NewNop(), "B1")
+			assert.Equal(t, true, errors.Is(err, tt.wantErr), "err: %v", err)
+			assert.Equal(t, map[string]int{tt.want: 1}, report.Counts)
+			assert.Equal(t, tt.want, saved.lines[2].Status)
+			assert.Equal(t, 0, bank.Calls(mockbank.PathVerify))
+		})
+	}
+}
+
+func TestPayoutSaveFails(t *testing.T) {
+	bank := mockbank.New(mockbank.Scenario{})
+	store := &memoryStore{states: map[string][]string{}}
+	transfer, closeBank := newTransfer(bank, store)
+	defer closeBank()
+
+	instructions := func(ctx context.Context, logger *zap.Logger, batchID string) ([]eft.PayoutLine, error) {
+		return eft.ParsePayoutFile([]byte("merchantTransID,proxyType,proxyValue,toBankCode,amount\nP1,ACCOUNT,1234567890,004,100.00\nP2,ACCOUNT,1234567890,004,200.00\n"), ',', batchID)
+	}
+	saves := 0
+	save := func(ctx context.Context, logger *zap.Logger, line eft.PayoutLine) error {
+		saves++
+		return errors.New("db down")
+	}
+	saved := &payoutLines{lines: map[int]eft.PayoutLine{}}
+	payout := eft.Payout(config.PayoutConfig{RatePerSecond: 1000}, instructions, saved.list(), transfer, store.get(), save)
+
+	report, err := payout(context.Background(), zap.NewNop(), "B1")
+	assert.Error(t, err)
+	assert.Equal(t, 3, saves)
+	// The run stops instead of paying lines it cannot record.
+	assert.Equal(t, 1, report.Processed)
+	assert.Equal(t, 1, bank.Calls(mockbank.PathTransfer))
+}
@@ -0,0 +1,241 @@
+package eft
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/kafka"
+	"go.uber.org/zap"
+)
+
+// PendingTransfer is a SUBMITTED or UNKNOWN transfer due for another inquiry.
+type PendingTransfer struct {
+	FundTransferRecord
+	InquiryAttempts int
+}
+
+// TransferException is what an escalated transfer is recorded and published as.
+type TransferException struct {
+	MerchantTransID string    `json:"merchantTransID"`
+	MerchantID      string    `json:"merchantID"`
+	RsTransID       string    `json:"rsTransID"`
+	Status          string    `json:"status"`
+	Amount          Amount    `json:"amount"`
+	InquiryAttempts int       `json:"inquiryAttempts"`
+	Reason          string    `json:"reason"`
+	CreatedAt       time.Time `json:"createdAt"`
+	EscalatedAt     time.Time `json:"escalatedAt"`
+}
+
+type PollReport struct {
+	Checked   int
+	Resolved  int
+	Pending   int
+	Escalated int
+	Errors    int
+}
+
+type ListPendingTransfersFunc func(ctx context.Context, logger *zap.Logger, createdBefore time.Time, limit int) ([]PendingTransfer, error)
+
+// ListPendingTransfers returns unescalated SUBMITTED and UNKNOWN transfers
+// created before createdBefore whose next inquiry is due, oldest first.
+func ListPendingTransfers(db *pgxpool.Pool) ListPendingTransfersFunc {
+	return func(ctx context.Context, logger *zap.Logger, createdBefore time.Time, limit int) ([]PendingTransfer, error) {
+		sql := `select merchant_trans_id, merchant_id, coalesce(rs_trans_id, ''), status, amount::text,
+				coalesce(to_bank_code, ''), coalesce(settlement_date, ''), coalesce(fail_msg, ''), created_at, updated_at,
+				inquiry_attempts
+				from fund_transfer
+				where status in ($1, $2)
+				  and created_at < $3
+				  and escalated_at is null
+				  and (next_inquiry_at is null or next_inquiry_at <= now())
+				order by created_at
+				limit $4`
+		rows, err := db.Query(ctx, sql, StateSubmitted, StateUnknown, createdBefore, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var pending []PendingTransfer
+		for rows.Next() {
+			var p PendingTransfer
+			err := rows.Scan(
+				&p.MerchantTransID,
+				&p.MerchantID,
+				&p.RsTransID,
+				&p.Status,
+				&p.Amount,
+				&p.ToBankCode,
+				&p.SettlementDate,
+				&p.FailMsg,
+				&p.CreatedAt,
+				&p.UpdatedAt,
+				&p.InquiryAttempts,
+			)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, p)
+		}
+		return pending, rows.Err()
+	}
+}
+
+type ScheduleInquiryFunc func(ctx context.Context, logger *zap.Logger, merchantTransID string, next time.Time) error
+
+func ScheduleInquiry(db *pgxpool.Pool) ScheduleInquiryFunc {
+	return func(ctx context.Context, logger *zap.Logger, merchantTransID string, next time.Time) error {
+		sql := `update fund_transfer set inquiry_attempts = inquiry_attempts + 1, next_inquiry_at = $2 where merchant_trans_id = $1`
+		_, err := db.Exec(ctx, sql, merchantTransID, next)
+		return err
+	}
+}
+
+// EscalateTransferFunc records an exception and takes the transfer out of polling.
+type EscalateTransferFunc func(ctx context.Context, logger *zap.Logger, exception TransferException) error
+
+func EscalateTransfer(db *pgxpool.Pool) EscalateTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, exception TransferException) error {
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func(tx pgx.Tx) {
+			_ = tx.Rollback(ctx)
+		}(tx)
+
+		sql := `insert into fund_transfer_exception (merchant_trans_id, status, inquiry_attempts, reason, created_at)
+				values ($1, $2, $3, $4, $5)
+				on conflict (merchant_trans_id) do nothing`
+		_, err = tx.Exec(ctx, sql, exception.MerchantTransID, exception.Status, exception.InquiryAttempts, exception.Reason, exception.EscalatedAt)
+		if err != nil {
+			return err
+		}
+		sql = `update fund_transfer set escalated_at = $2 where merchant_trans_id = $1`
+		if _, err = tx.Exec(ctx, sql, exception.MerchantTransID, exception.EscalatedAt); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+}
+
+// PublishTransferExceptionToKafka is an EscalateTransferFunc for the
+// exceptions topic; it does not stop polling on its own, so it must run before
+// EscalateTransfer. Consumers may see an exception more than once.
+func PublishTransferExceptionToKafka(send kafka.SendMessageSyncWithTopicFunc, topic string) EscalateTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, exception TransferException) error {
+		return send(logger, exception, topic)
+	}
+}
+
+type PollInquiryFunc func(ctx context.Context, logger *zap.Logger) (*PollReport, error)
+
+// PollInquiry resolves one batch of pending transfers. Transfers the bank
+// still reports in process are retried with a per-transfer backoff. Those
+// older than cfg.Cutoff get one last inquiry and, if still open, are escalated
+// through the EscalateTransferFuncs in order, stopping at the first error. The
+// last one must take them out of polling, so a failed sink leaves the transfer
+// to be escalated again on the next poll.
+func PollInquiry(
+	cfg config.InquiryPollerConfig,
+	ListPendingTransfersFunc ListPendingTransfersFunc,
+	ResolveTransferFunc ResolveTransferFunc,
+	ScheduleInquiryFunc ScheduleInquiryFunc,
+	EscalateTransferFuncs ...EscalateTransferFunc,
+) PollInquiryFunc {
+	backoff := RetryPolicy{BaseDelay: cfg.BaseDelay, MaxDelay: cfg.MaxDelay, Multiplier: 2}
+
+	return func(ctx context.Context, logger *zap.Logger) (*PollReport, error) {
+		now := time.Now()
+		pending, err := ListPendingTransfersFunc(ctx, logger, now.Add(-cfg.MinAge), cfg.Batch)
+		if err != nil {
+			logger.Error("Error ListPendingTransfersFunc", zap.Error(err))
+			return nil, err
+		}
+
+		report := &PollReport{}
+		for _, transfer := range pending {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			report.Checked++
+			log := logger.With(zap.String("merchantTransID", transfer.MerchantTransID))
+
+			result, err := ResolveTransferFunc(ctx, log, transfer.FundTransferRecord)
+			if err == nil && IsFinalState(result.Status) {
+				report.Resolved++
+				continue
+			}
+
+			if now.Sub(transfer.CreatedAt) > cfg.Cutoff {
+				if err != nil {
+					log.Error("Error ResolveTransferFunc", zap.Error(err))
+				}
+				exception := TransferException{
+					MerchantTransID: transfer.MerchantTransID,
+					MerchantID:      transfer.MerchantID,
+					RsTransID:       transfer.RsTransID,
+					Status:          transfer.Status,
+					Amount:          transfer.Amount,
+					InquiryAttempts: transfer.InquiryAttempts,
+					Reason:          fmt.Sprintf("unresolved after %s", cfg.Cutoff),
+					CreatedAt:       transfer.CreatedAt,
+					EscalatedAt:     now,
+				}
+				escalated := true
+				for _, escalate := range EscalateTransferFuncs {
+					if err := escalate(ctx, log, exception); err != nil {
+						log.Error("Error EscalateTransferFunc", zap.Error(err))
+						escalated = false
+						break
+					}
+				}
+				if escalated {
+					log.Warn("transfer escalated", zap.String("status", transfer.Status), zap.Int("inquiryAttempts", transfer.InquiryAttempts))
+					report.Escalated++
+				} else {
+					report.Errors++
+				}
+				continue
+			}
+
+			if err != nil {
+				log.Error("Error ResolveTransferFunc", zap.Error(err))
+				report.Errors++
+			} else {
+				report.Pending++
+			}
+
+			next := now.Add(backoff.Backoff(transfer.InquiryAttempts + 1))
+			if err := ScheduleInquiryFunc(ctx, log, transfer.MerchantTransID, next); err != nil {
+				log.Error("Error ScheduleInquiryFunc", zap.Error(err))
+			}
+		}
+
+		logger.Info("inquiry poll",
+			zap.Int("checked", report.Checked),
+			zap.Int("resolved", report.Resolved),
+			zap.Int("pending", report.Pending),
+			zap.Int("escalated", report.Escalated),
+			zap.Int("errors", report.Errors),
+		)
+		return report, nil
+	}
+}
+
+// RunInquiryPoller polls every interval until ctx is done.
+func RunInquiryPoller(ctx context.Context, logger *zap.Logger, interval time.Duration, PollInquiryFunc PollInquiryFunc) error {
+	for {
+		if _, err := PollInquiryFunc(ctx, logger); err != nil && ctx.Err() == nil {
+			logger.Error("Error PollInquiryFunc", zap.Error(err))
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return nil
+		}
+	}
+}
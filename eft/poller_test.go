@@ -0,0 +1,76 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+func TestPollInquiry(t *testing.T) {
+	cfg := config.InquiryPollerConfig{Cutoff: time.Hour, BaseDelay: time.Minute, MaxDelay: time.Hour, Batch: 10}
+	errKafka := errors.New("kafka down")
+
+	tests := []struct {
+		name      string
+		age       time.Duration
+		resolved  string
+		resolve   error
+		publish   error
+		report    PollReport
+		published int
+		taken     int
+		scheduled int
+	}{
+		{name: "resolved", age: time.Minute, resolved: StateSuccess, report: PollReport{Checked: 1, Resolved: 1}},
+		{name: "still in process", age: time.Minute, resolved: StateUnknown, report: PollReport{Checked: 1, Pending: 1}, scheduled: 1},
+		{name: "inquiry failed", age: time.Minute, resolve: errors.New("bank down"), report: PollReport{Checked: 1, Errors: 1}, scheduled: 1},
+		{name: "resolved by last inquiry", age: 2 * time.Hour, resolved: StateFailed, report: PollReport{Checked: 1, Resolved: 1}},
+		{name: "escalated", age: 2 * time.Hour, resolved: StateUnknown, report: PollReport{Checked: 1, Escalated: 1}, published: 1, taken: 1},
+		{name: "escalated without inquiry", age: 2 * time.Hour, resolve: errors.New("bank down"), report: PollReport{Checked: 1, Escalated: 1}, published: 1, taken: 1},
+		{name: "publish failed", age: 2 * time.Hour, resolved: StateUnknown, publish: errKafka, report: PollReport{Checked: 1, Errors: 1}, published: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer := PendingTransfer{FundTransferRecord: FundTransferRecord{MerchantTransID: "T1", Status: StateUnknown, CreatedAt: time.Now().Add(-tt.age)}}
+			list := func(ctx context.Context, logger *zap.Logger, createdBefore time.Time, limit int) ([]PendingTransfer, error) {
+				return []PendingTransfer{transfer}, nil
+			}
+			inquiries := 0
+			resolve := func(ctx context.Context, logger *zap.Logger, record FundTransferRecord) (*TransferResult, error) {
+				inquiries++
+				if tt.resolve != nil {
+					return nil, tt.resolve
+				}
+				return &TransferResult{MerchantTransID: record.MerchantTransID, Status: tt.resolved}, nil
+			}
+			scheduled := 0
+			schedule := func(ctx context.Context, logger *zap.Logger, merchantTransID string, next time.Time) error {
+				scheduled++
+				return nil
+			}
+			published, taken := 0, 0
+			publish := func(ctx context.Context, logger *zap.Logger, exception TransferException) error {
+				published++
+				assert.Equal(t, "T1", exception.MerchantTransID)
+				return tt.publish
+			}
+			takeOut := func(ctx context.Context, logger *zap.Logger, exception TransferException) error {
+				taken++
+				return nil
+			}
+
+			report, err := PollInquiry(cfg, list, resolve, schedule, publish, takeOut)(context.Background(), zap.NewNop())
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.report, *report)
+			assert.Equal(t, 1, inquiries)
+			assert.Equal(t, tt.published, published)
+			assert.Equal(t, tt.taken, taken)
+			assert.Equal(t, tt.scheduled, scheduled)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+// callWithToken retries call once with a fresh token when the bank answers 401.
+func callWithToken(
+	ctx context.Context,
+	logger *zap.Logger,
+	GetAccessTokenFunc GetAccessTokenFunc,
+	InvalidateAccessTokenFunc InvalidateAccessTokenFunc,
+	call func(accessToken string) error,
+) error {
+	accessToken, err := GetAccessTokenFunc(ctx, logger)
+	if err != nil {
+		logger.Error("Error GetAccessTokenFunc", zap.Error(err))
+		return err
+	}
+	err = call(accessToken)
+	if !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+	if err := InvalidateAccessTokenFunc(ctx, logger, accessToken); err != nil {
+		logger.Error("Error InvalidateAccessTokenFunc", zap.Error(err))
+	}
+	accessToken, err = GetAccessTokenFunc(ctx, logger)
+	if err != nil {
+		logger.Error("Error GetAccessTokenFunc", zap.Error(err))
+		return err
+	}
+	return call(accessToken)
+}
+
+func resultFromRecord(record FundTransferRecord) *TransferResult {
+	return &TransferResult{
+		MerchantTransID: record.MerchantTransID,
+		RsTransID:       record.RsTransID,
+		Status:          record.Status,
+		SettlementDate:  record.SettlementDate,
+		FailMsg:         record.FailMsg,
+	}
+}
+
+// ResolveTransferFunc asks the bank once for the status of a transfer that was
+// submitted but never settled, and records the answer. Transfers still in
+// process end up in UNKNOWN. A transfer never submitted is failed once it is
+// older than cfg.AbandonAfter and is ErrTransferInProgress until then.
+type ResolveTransferFunc func(ctx context.Context, logger *zap.Logger, record FundTransferRecord) (*TransferResult, error)
+
+func ResolveTransfer(
+	cfg config.EFTConfig,
+	GetAccessTokenFunc GetAccessTokenFunc,
+	InvalidateAccessTokenFunc InvalidateAccessTokenFunc,
+	HTTPInquiryStatusFundTransferFunc HTTPInquiryStatusFundTransferFunc,
+	TransitFundTransferFunc TransitFundTransferFunc,
+) ResolveTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, record FundTransferRecord) (*TransferResult, error) {
+		result := resultFromRecord(record)
+		if IsFinalState(record.Status) {
+			return result, nil
+		}
+		if record.Status != StateSubmitted && record.Status != StateUnknown {
+			return abandonTransfer(ctx, logger, cfg, TransitFundTransferFunc, record)
+		}
+
+		inquiryReq := InquiryStatusRequest{
+			MerchantID:      record.MerchantID,
+			RequestDateTime: time.Now().Format(time.RFC3339),
+			MerchantTransID: record.MerchantTransID,
+			RsTransID:       record.RsTransID,
+		}
+		var inquiry *InquiryStatusResponse
+		err := callWithToken(ctx, logger, GetAccessTokenFunc, InvalidateAccessTokenFunc, func(accessToken string) (err error) {
+			inquiry, err = HTTPInquiryStatusFundTransferFunc(ctx, logger, inquiryReq, fmt.Sprintf("Bearer %s", accessToken))
+			return err
+		})
+		if err != nil {
+			logger.Error("Error HTTPInquiryStatusFundTransferFunc", zap.Error(err))
+			return result, err
+		}
+		result.Inquiries = append(result.Inquiries, inquiry)
+
+		transition := Transition{
+			MerchantTransID: record.MerchantTransID,
+			To:              StateUnknown,
+			Request:         inquiryReq,
+			Response:        inquiry,
+		}
+		switch inquiry.TxnStatus {
+		case TxnStatusSuccess:
+			transition.To = StateSuccess
+			transition.SettlementDate = inquiry.SettlementDate
+			result.SettlementDate = inquiry.SettlementDate
+		case TxnStatusFail:
+			transition.To = StateFailed
+			transition.FailMsg = inquiry.FailMsg
+			result.FailMsg = inquiry.FailMsg
+		}
+		if err := TransitFundTransferFunc(ctx, logger, transition); err != nil {
+			logger.Error("Error TransitFundTransferFunc", zap.String("to", transition.To), zap.Error(err))
+			return result, err
+		}
+		result.Status = transition.To
+		return result, nil
+	}
+}
+
+// abandonTransfer fails a transfer whose worker stopped before confirm.
+// SUBMITTED is recorded before the confirm is sent, so the bank never saw
+// it; From guards against a worker that moved on after record was read.
+func abandonTransfer(
+	ctx context.Context,
+	logger *zap.Logger,
+	cfg config.EFTConfig,
+	TransitFundTransferFunc TransitFundTransferFunc,
+	record FundTransferRecord,
+) (*TransferResult, error) {
+	result := resultFromRecord(record)
+	if time.Since(record.UpdatedAt) < cfg.AbandonAfter {
+		return result, fmt.Errorf("%w: %s is %s", ErrTransferInProgress, record.MerchantTransID, record.Status)
+	}
+	msg := fmt.Sprintf("abandoned in %s before confirm", record.Status)
+	err := TransitFundTransferFunc(ctx, logger, Transition{
+		MerchantTransID: record.MerchantTransID,
+		From:            record.Status,
+		To:              StateFailed,
+		FailMsg:         msg,
+	})
+	if err != nil {
+		logger.Error("Error TransitFundTransferFunc", zap.String("to", StateFailed), zap.Error(err))
+		return result, err
+	}
+	logger.Warn("abandoned transfer failed", zap.String("from", record.Status), zap.Time("updatedAt", record.UpdatedAt))
+	result.Status = StateFailed
+	result.FailMsg = msg
+	return result, nil
+}
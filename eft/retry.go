@@ -0,0 +1,190 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+var defaultRetryableStatus = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// HTTPStatusError is a non-2xx answer from the bank, with the body read out.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("error call %s status: %d body: %s", e.URL, e.StatusCode, e.Body)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type RetryPolicy struct {
+	MaxAttempts     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	Multiplier      float64
+	Jitter          float64
+	Deadline        time.Duration
+	RetryableStatus []int
+}
+
+func NewRetryPolicy(cfg config.RetryConfig) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts:     cfg.MaxAttempts,
+		BaseDelay:       cfg.BaseDelay,
+		MaxDelay:        cfg.MaxDelay,
+		Multiplier:      cfg.Multiplier,
+		Jitter:          cfg.Jitter,
+		Deadline:        cfg.Deadline,
+		RetryableStatus: cfg.RetryableStatus,
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 1
+	}
+	if len(policy.RetryableStatus) == 0 {
+		policy.RetryableStatus = defaultRetryableStatus
+	}
+	return policy
+}
+
+// Backoff is the wait before the given retry (1 for the first retry):
+// BaseDelay*Multiplier^(retry-1), capped at MaxDelay, then spread by ±Jitter.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+// Retryable reports whether err is worth another attempt: network failures
+// and the configured HTTP statuses are; permanent errors, cancellation, an
+// open circuit breaker and a response failing signature checks are not.
+func (p RetryPolicy) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) || errors.Is(err, context.Canceled) || errors.Is(err, ErrUnauthorized) ||
+		errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrSignatureInvalid) {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		for _, status := range p.RetryableStatus {
+			if status == statusErr.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+	var gwErr *GatewayError
+	if errors.As(err, &gwErr) {
+		return gwErr.Retryable
+	}
+	// Transport failures and anything else unclassified are worth another try.
+	return true
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, runs out of
+// attempts or passes the deadline. fn gets ctx bounded by the deadline, so an
+// attempt in flight is cut off with it. Waits between attempts stop early when
+// ctx is done.
+func (p RetryPolicy) Do(ctx context.Context, logger *zap.Logger, fn func(ctx context.Context, attempt int) error) error {
+	if p.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Deadline)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 1; attempt <= p.MaxAttempts; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if err == nil {
+				return ctxErr
+			}
+			return fmt.Errorf("%w (last error: %v)", ctxErr, err)
+		}
+
+		err = fn(ctx, attempt)
+		if err == nil {
+			return nil
+		}
+		if !p.Retryable(err) {
+			var permanent *permanentError
+			if errors.As(err, &permanent) {
+				return permanent.err
+			}
+			return err
+		}
+		if attempt == p.MaxAttempts {
+			break
+		}
+
+		wait := p.Backoff(attempt)
+		logger.Warn("retrying eft call", zap.Int("attempt", attempt), zap.Duration("wait", wait), zap.Error(err))
+		if ctxErr := sleep(ctx, wait); ctxErr != nil {
+			return fmt.Errorf("%w (last error: %v)", ctxErr, err)
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", p.MaxAttempts, err)
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// withTimeout bounds a single bank call; a zero timeout leaves ctx as is.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,84 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	logger := zap.NewNop()
+	policy := NewRetryPolicy(config.RetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    3 * time.Millisecond,
+		Multiplier:  2,
+	})
+
+	assert.Equal(t, time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 2*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 3*time.Millisecond, policy.Backoff(5))
+
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{name: "transport error", err: errors.New("connection reset"), attempts: 3},
+		{name: "retryable status", err: &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, attempts: 3},
+		{name: "client status", err: &HTTPStatusError{StatusCode: http.StatusBadRequest}, attempts: 1},
+		{name: "unauthorized", err: ErrUnauthorized, attempts: 1},
+		{name: "permanent", err: Permanent(errors.New("bad json")), attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := policy.Do(context.Background(), logger, func(ctx context.Context, attempt int) error {
+				attempts++
+				return tt.err
+			})
+			assert.Equal(t, tt.attempts, attempts)
+			assert.Error(t, err)
+		})
+	}
+
+	attempts := 0
+	err := policy.Do(context.Background(), logger, func(ctx context.Context, attempt int) error {
+		attempts++
+		if attempt < 2 {
+			return errors.New("timeout")
+		}
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = policy.Do(ctx, logger, func(ctx context.Context, attempt int) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRetryPolicyDeadlineReachesAttempt(t *testing.T) {
+	policy := NewRetryPolicy(config.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, Deadline: 20 * time.Millisecond})
+
+	// A hung call is cut off at the deadline instead of outliving it.
+	start := time.Now()
+	attempts := 0
+	err := policy.Do(context.Background(), zap.NewNop(), func(ctx context.Context, attempt int) error {
+		attempts++
+		_, hasDeadline := ctx.Deadline()
+		assert.Equal(t, true, hasDeadline)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, true, time.Since(start) < time.Second)
+}
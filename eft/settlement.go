@@ -0,0 +1,318 @@
+package eft
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/sftp"
+	"go.uber.org/zap"
+)
+
+var ErrUnresolvedTransfers = errors.New("fund transfers still unresolved at cut-off")
+
+// SettlementGroup totals the transfers sharing a settlement date, status,
+// receiving bank and transfer type.
+type SettlementGroup struct {
+	SettlementDate string `json:"settlementDate"`
+	Status         string `json:"status"`
+	ToBankCode     string `json:"toBankCode"`
+	TransType      string `json:"transType"`
+	Count          int    `json:"count"`
+	Amount         Amount `json:"amount"`
+}
+
+type SettlementTotal struct {
+	Count  int    `json:"count"`
+	Amount Amount `json:"amount"`
+}
+
+// UnresolvedTransfer is a transfer created before the cut-off that was not
+// SUCCESS or FAILED when the report ran, whichever day it was created.
+type UnresolvedTransfer struct {
+	MerchantTransID string    `json:"merchantTransID"`
+	RsTransID       string    `json:"rsTransID,omitempty"`
+	Status          string    `json:"status"`
+	Amount          Amount    `json:"amount"`
+	ToBankCode      string    `json:"toBankCode"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+type SettlementSummary struct {
+	BusinessDate string                     `json:"businessDate"`
+	GeneratedAt  time.Time                  `json:"generatedAt"`
+	Groups       []SettlementGroup          `json:"groups"`
+	Totals       map[string]SettlementTotal `json:"totals"`
+	Unresolved   []UnresolvedTransfer       `json:"unresolved"`
+	OK           bool                       `json:"ok"`
+}
+
+// SummarizeSettlement groups the day's transfers, totals them by status and
+// lists the ones not yet final, together with the still open transfers of
+// earlier days in open. Groups are sorted by their key columns.
+func SummarizeSettlement(businessDate string, records, open []FundTransferRecord) *SettlementSummary {
+	summary := &SettlementSummary{
+		BusinessDate: businessDate,
+		GeneratedAt:  time.Now(),
+		Groups:       []SettlementGroup{},
+		Totals:       map[string]SettlementTotal{},
+		Unresolved:   []UnresolvedTransfer{},
+	}
+
+	unresolved := map[string]bool{}
+	addUnresolved := func(record FundTransferRecord) {
+		if IsFinalState(record.Status) || unresolved[record.MerchantTransID] {
+			return
+		}
+		unresolved[record.MerchantTransID] = true
+		summary.Unresolved = append(summary.Unresolved, UnresolvedTransfer{
+			MerchantTransID: record.MerchantTransID,
+			RsTransID:       record.RsTransID,
+			Status:          record.Status,
+			Amount:          record.Amount,
+			ToBankCode:      record.ToBankCode,
+			CreatedAt:       record.CreatedAt,
+		})
+	}
+
+	type groupKey struct{ settlementDate, status, toBankCode, transType string }
+	groups := map[groupKey]*SettlementGroup{}
+	for _, record := range records {
+		key := groupKey{record.SettlementDate, record.Status, record.ToBankCode, record.TransType}
+		group, ok := groups[key]
+		if !ok {
+			group = &SettlementGroup{SettlementDate: key.settlementDate, Status: key.status, ToBankCode: key.toBankCode, TransType: key.transType}
+			groups[key] = group
+		}
+		group.Count++
+		group.Amount = Amount{group.Amount.Add(record.Amount.Decimal)}
+
+		total := summary.Totals[record.Status]
+		total.Count++
+		total.Amount = Amount{total.Amount.Add(record.Amount.Decimal)}
+		summary.Totals[record.Status] = total
+		addUnresolved(record)
+	}
+	for _, record := range open {
+		addUnresolved(record)
+	}
+
+	for _, group := range groups {
+		summary.Groups = append(summary.Groups, *group)
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		a, b := summary.Groups[i], summary.Groups[j]
+		if a.SettlementDate != b.SettlementDate {
+			return a.SettlementDate < b.SettlementDate
+		}
+		if a.Status != b.Status {
+			return a.Status < b.Status
+		}
+		if a.ToBankCode != b.ToBankCode {
+			return a.ToBankCode < b.ToBankCode
+		}
+		return a.TransType < b.TransType
+	})
+	sort.Slice(summary.Unresolved, func(i, j int) bool {
+		return summary.Unresolved[i].CreatedAt.Before(summary.Unresolved[j].CreatedAt)
+	})
+	summary.OK = len(summary.Unresolved) == 0
+	return summary
+}
+
+// SettlementSummaryCSV writes one row per group.
+func SettlementSummaryCSV(summary SettlementSummary) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{"settlementDate", "status", "toBankCode", "transType", "count", "amount"})
+	for _, group := range summary.Groups {
+		_ = writer.Write([]string{
+			group.SettlementDate,
+			group.Status,
+			group.ToBankCode,
+			group.TransType,
+			strconv.Itoa(group.Count),
+			group.Amount.String(),
+		})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+type ListDailyTransfersFunc func(ctx context.Context, logger *zap.Logger, businessDate string) ([]FundTransferRecord, error)
+
+// ListDailyTransfers returns transfers settled on businessDate plus those
+// created that day without a settlement date, which are the failed and the
+// still unresolved ones.
+func ListDailyTransfers(db *pgxpool.Pool) ListDailyTransfersFunc {
+	return func(ctx context.Context, logger *zap.Logger, businessDate string) ([]FundTransferRecord, error) {
+		start, err := time.ParseInLocation("20060102", businessDate, time.Local)
+		if err != nil {
+			return nil, err
+		}
+
+		sql := `select ` + fundTransferRecordColumns + `
+				from fund_transfer
+				where settlement_date = $1
+				   or (settlement_date is null and created_at >= $2 and created_at < $3)`
+		rows, err := db.Query(ctx, sql, businessDate, start, start.AddDate(0, 0, 1))
+		if err != nil {
+			return nil, err
+		}
+		return scanFundTransferRecords(rows)
+	}
+}
+
+type ListOpenTransfersFunc func(ctx context.Context, logger *zap.Logger, createdBefore time.Time) ([]FundTransferRecord, error)
+
+// ListOpenTransfers returns every transfer created before createdBefore that
+// is neither SUCCESS nor FAILED, however many days ago it was created.
+func ListOpenTransfers(db *pgxpool.Pool) ListOpenTransfersFunc {
+	return func(ctx context.Context, logger *zap.Logger, createdBefore time.Time) ([]FundTransferRecord, error) {
+		sql := `select ` + fundTransferRecordColumns + `
+				from fund_transfer
+				where status not in ($1, $2)
+				  and created_at < $3
+				order by created_at`
+		rows, err := db.Query(ctx, sql, StateSuccess, StateFailed, createdBefore)
+		if err != nil {
+			return nil, err
+		}
+		return scanFundTransferRecords(rows)
+	}
+}
+
+func scanFundTransferRecords(rows pgx.Rows) ([]FundTransferRecord, error) {
+	defer rows.Close()
+
+	var records []FundTransferRecord
+	for rows.Next() {
+		var record FundTransferRecord
+		if err := scanFundTransferRecord(rows, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+type PublishSettlementSummaryFunc func(ctx context.Context, logger *zap.Logger, summary SettlementSummary) error
+
+func settlementSummaryFiles(cfg config.SettlementReportConfig, summary SettlementSummary) (map[string][]byte, error) {
+	csvBody, err := SettlementSummaryCSV(summary)
+	if err != nil {
+		return nil, err
+	}
+	jsonBody, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		fmt.Sprintf(cfg.CSVKey, summary.BusinessDate):  csvBody,
+		fmt.Sprintf(cfg.JSONKey, summary.BusinessDate): jsonBody,
+	}, nil
+}
+
+func PutSettlementSummaryToS3(svc *s3.S3, bucket string, cfg config.SettlementReportConfig) PublishSettlementSummaryFunc {
+	return func(ctx context.Context, logger *zap.Logger, summary SettlementSummary) error {
+		files, err := settlementSummaryFiles(cfg, summary)
+		if err != nil {
+			return err
+		}
+		for key, body := range files {
+			_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+				Bucket: &bucket,
+				Key:    aws.String(key),
+				Body:   bytes.NewReader(body),
+			})
+			if err != nil {
+				return err
+			}
+			logger.Info("settlement summary written", zap.String("key", key))
+		}
+		return nil
+	}
+}
+
+func UploadSettlementSummary(client *sftp.Client, cfg config.SettlementReportConfig) PublishSettlementSummaryFunc {
+	return func(ctx context.Context, logger *zap.Logger, summary SettlementSummary) error {
+		files, err := settlementSummaryFiles(cfg, summary)
+		if err != nil {
+			return err
+		}
+		for path, body := range files {
+			if err := client.Upload(path, body); err != nil {
+				return fmt.Errorf("upload settlement summary %s: %w", path, err)
+			}
+			logger.Info("settlement summary uploaded", zap.String("path", path))
+		}
+		return nil
+	}
+}
+
+type SettlementReportFunc func(ctx context.Context, logger *zap.Logger, businessDate string) (*SettlementSummary, error)
+
+// SettlementReport returns ErrUnresolvedTransfers once the summary has been
+// published if any transfer created before the end of businessDate, that day
+// or earlier, was neither SUCCESS nor FAILED.
+func SettlementReport(
+	ListDailyTransfersFunc ListDailyTransfersFunc,
+	ListOpenTransfersFunc ListOpenTransfersFunc,
+	PublishSettlementSummaryFuncs ...PublishSettlementSummaryFunc,
+) SettlementReportFunc {
+	return func(ctx context.Context, logger *zap.Logger, businessDate string) (*SettlementSummary, error) {
+		logger = logger.With(zap.String("businessDate", businessDate))
+
+		records, err := ListDailyTransfersFunc(ctx, logger, businessDate)
+		if err != nil {
+			logger.Error("Error ListDailyTransfersFunc", zap.Error(err))
+			return nil, err
+		}
+
+		start, err := time.ParseInLocation("20060102", businessDate, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		open, err := ListOpenTransfersFunc(ctx, logger, start.AddDate(0, 0, 1))
+		if err != nil {
+			logger.Error("Error ListOpenTransfersFunc", zap.Error(err))
+			return nil, err
+		}
+
+		summary := SummarizeSettlement(businessDate, records, open)
+		logger.Info("settlement summarized",
+			zap.Int("transfers", len(records)),
+			zap.Int("groups", len(summary.Groups)),
+			zap.Int("unresolved", len(summary.Unresolved)),
+		)
+		for _, unresolved := range summary.Unresolved {
+			logger.Warn("transfer unresolved at cut-off",
+				zap.String("merchantTransID", unresolved.MerchantTransID),
+				zap.String("status", unresolved.Status),
+				zap.Time("createdAt", unresolved.CreatedAt),
+			)
+		}
+
+		for _, publish := range PublishSettlementSummaryFuncs {
+			if err := publish(ctx, logger, *summary); err != nil {
+				logger.Error("Error PublishSettlementSummaryFunc", zap.Error(err))
+				return summary, err
+			}
+		}
+		if !summary.OK {
+			return summary, ErrUnresolvedTransfers
+		}
+		return summary, nil
+	}
+}
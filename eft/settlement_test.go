@@ -0,0 +1,116 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSummarizeSettlement(t *testing.T) {
+	created := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	record := func(merchantTransID, status, toBankCode, amount, settlementDate string) FundTransferRecord {
+		return FundTransferRecord{
+			MerchantTransID: merchantTransID,
+			Status:          status,
+			Amount:          MustAmount(amount),
+			ToBankCode:      toBankCode,
+			TransType:       "TRANSFER",
+			SettlementDate:  settlementDate,
+			CreatedAt:       created,
+		}
+	}
+	summary := SummarizeSettlement("20240101", []FundTransferRecord{
+		record("T1", StateSuccess, "004", "100.50", "20240101"),
+		record("T2", StateSuccess, "004", "200", "20240101"),
+		record("T3", StateSuccess, "014", "50", "20240101"),
+		record("T4", StateFailed, "004", "75", ""),
+		record("T5", StateUnknown, "004", "10", ""),
+	}, nil)
+
+	assert.Equal(t, false, summary.OK)
+	assert.Equal(t, []UnresolvedTransfer{{MerchantTransID: "T5", Status: StateUnknown, Amount: MustAmount("10"), ToBankCode: "004", CreatedAt: created}}, summary.Unresolved)
+	assert.Equal(t, "350.50", summary.Totals[StateSuccess].Amount.String())
+	assert.Equal(t, 3, summary.Totals[StateSuccess].Count)
+
+	body, err := SettlementSummaryCSV(*summary)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `settlementDate,status,toBankCode,transType,count,amount
+,FAILED,004,TRANSFER,1,75.00
+,UNKNOWN,004,TRANSFER,1,10.00
+20240101,SUCCESS,004,TRANSFER,2,300.50
+20240101,SUCCESS,014,TRANSFER,1,50.00
+`, string(body))
+}
+
+func TestSettlementReportOpenFromEarlierDays(t *testing.T) {
+	day := time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+	daily := func(ctx context.Context, logger *zap.Logger, businessDate string) ([]FundTransferRecord, error) {
+		return []FundTransferRecord{
+			{MerchantTransID: "T1", Status: StateSuccess, Amount: MustAmount("100"), SettlementDate: "20240102", CreatedAt: day},
+			{MerchantTransID: "T2", Status: StateSubmitted, Amount: MustAmount("20"), SettlementDate: "20240102", CreatedAt: day},
+		}, nil
+	}
+	var cutoff time.Time
+	open := func(ctx context.Context, logger *zap.Logger, createdBefore time.Time) ([]FundTransferRecord, error) {
+		cutoff = createdBefore
+		// T0 was sent two days ago and is still open; T2 is also in the day's list.
+		return []FundTransferRecord{
+			{MerchantTransID: "T0", Status: StateSubmitted, Amount: MustAmount("5"), CreatedAt: day.AddDate(0, 0, -2)},
+			{MerchantTransID: "T2", Status: StateSubmitted, Amount: MustAmount("20"), SettlementDate: "20240102", CreatedAt: day},
+		}, nil
+	}
+	var published SettlementSummary
+	publish := func(ctx context.Context, logger *zap.Logger, summary SettlementSummary) error {
+		published = summary
+		return nil
+	}
+
+	summary, err := SettlementReport(daily, open, publish)(context.Background(), zap.NewNop(), "20240102")
+	assert.Equal(t, true, errors.Is(err, ErrUnresolvedTransfers))
+	assert.Equal(t, time.Date(2024, 1, 3, 0, 0, 0, 0, time.Local), cutoff)
+	assert.Equal(t, published.Unresolved, summary.Unresolved)
+	assert.Equal(t, 2, len(summary.Unresolved))
+	assert.Equal(t, "T0", summary.Unresolved[0].MerchantTransID)
+	assert.Equal(t, "T2", summary.Unresolved[1].MerchantTransID)
+	// Earlier days' transfers do not count toward the day's totals.
+	assert.Equal(t, 1, summary.Totals[StateSubmitted].Count)
+}
+
+// recordRow answers Scan with one fund_transfer row, in select order.
+type recordRow []interface{}
+
+func (r recordRow) Scan(dest ...interface{}) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("scan %d columns into %d destinations", len(r), len(dest))
+	}
+	for i, value := range r {
+		switch d := dest[i].(type) {
+		case *string:
+			*d = value.(string)
+		case *time.Time:
+			*d = value.(time.Time)
+		case *Amount:
+			if err := d.Scan(value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected destination %T", dest[i])
+		}
+	}
+	return nil
+}
+
+func TestScanFundTransferRecord(t *testing.T) {
+	created := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	var record FundTransferRecord
+	err := scanFundTransferRecord(recordRow{"T1", "M1", "", StateUnknown, "0", "004", "PAYOUT", "", "", created, created}, &record)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "PAYOUT", record.TransType)
+	assert.Equal(t, "004", record.ToBankCode)
+	assert.Equal(t, MustAmount("0"), record.Amount)
+}
@@ -0,0 +1,195 @@
+package eft
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+const (
+	SigningDetached = "DETACHED"
+	SigningCompact  = "COMPACT"
+
+	joseContentType = "application/jose"
+)
+
+// SignRequestFunc returns the body to send in place of body, setting any
+// signature header it needs on header.
+type SignRequestFunc func(header http.Header, body []byte) ([]byte, error)
+
+// VerifyResponseFunc returns the verified plain payload of a bank response,
+// or an error wrapping ErrSignatureInvalid.
+type VerifyResponseFunc func(header http.Header, body []byte) ([]byte, error)
+
+// JOSESigner signs with the environment's private key and verifies with the
+// bank's public key. In DETACHED mode the body goes out as is with a
+// detached JWS in cfg.Header; in COMPACT mode the body becomes the JWS.
+// With cfg.Encrypt the outgoing body is then wrapped in a JWE for the bank's
+// key, and responses are expected as JWE for ours.
+func JOSESigner(cfg config.SigningConfig, privateKey []byte) (SignRequestFunc, VerifyResponseFunc, error) {
+	key, err := ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("signing private key: %w", err)
+	}
+	bankKey, err := ParsePublicKey(cfg.BankPublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bank public key: %w", err)
+	}
+	if cfg.Mode != SigningDetached && cfg.Mode != SigningCompact {
+		return nil, nil, fmt.Errorf("unsupported signing mode %q", cfg.Mode)
+	}
+	signer, err := NewJWSSigner(key, cfg.Alg, cfg.KeyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !supportedAlg(cfg.BankAlg) {
+		return nil, nil, fmt.Errorf("unsupported bank JWS alg %q", cfg.BankAlg)
+	}
+	verifier := JWSVerifier{Key: bankKey, Alg: cfg.BankAlg}
+
+	var encryptKey *rsa.PublicKey
+	var decryptKey *rsa.PrivateKey
+	if cfg.Encrypt {
+		var ok bool
+		if encryptKey, ok = bankKey.(*rsa.PublicKey); !ok {
+			return nil, nil, errors.New("encryption needs an RSA bank public key")
+		}
+		if decryptKey, ok = key.(*rsa.PrivateKey); !ok {
+			return nil, nil, errors.New("encryption needs an RSA private key")
+		}
+	}
+
+	sign := func(header http.Header, body []byte) ([]byte, error) {
+		out := body
+		if cfg.Mode == SigningDetached {
+			token, err := signer.SignDetached(body)
+			if err != nil {
+				return nil, err
+			}
+			header.Set(cfg.Header, token)
+		} else {
+			token, err := signer.Sign(body)
+			if err != nil {
+				return nil, err
+			}
+			out = []byte(token)
+			header.Set("Content-Type", joseContentType)
+		}
+		if encryptKey != nil {
+			token, err := EncryptJWE(out, encryptKey, cfg.BankKeyID)
+			if err != nil {
+				return nil, err
+			}
+			out = []byte(token)
+			header.Set("Content-Type", joseContentType)
+		}
+		return out, nil
+	}
+
+	verify := func(header http.Header, body []byte) ([]byte, error) {
+		body = bytes.TrimSpace(body)
+		if decryptKey != nil {
+			plain, err := DecryptJWE(string(body), decryptKey)
+			if err != nil {
+				return nil, fmt.Errorf("%w: decrypt: %v", ErrSignatureInvalid, err)
+			}
+			body = plain
+		}
+		if cfg.Mode == SigningCompact {
+			return verifier.Verify(string(body))
+		}
+		token := header.Get(cfg.Header)
+		if token == "" {
+			return nil, fmt.Errorf("%w: missing %s header", ErrSignatureInvalid, cfg.Header)
+		}
+		if err := verifier.VerifyDetached(token, body); err != nil {
+			return nil, err
+		}
+		return body, nil
+	}
+	return sign, verify, nil
+}
+
+type signingTransport struct {
+	next   http.RoundTripper
+	sign   SignRequestFunc
+	verify VerifyResponseFunc
+	logger *zap.Logger
+}
+
+// SigningTransport signs JSON request bodies and verifies the responses to
+// them, failing closed: a response that does not verify is dropped and the
+// call fails with ErrSignatureInvalid. Only 5xx and 408 answers may come back
+// unsigned, as load balancers in front of the bank send those; they are
+// never taken as a business outcome. Other requests, like the form encoded
+// OAuth call, pass through untouched.
+func SigningTransport(next http.RoundTripper, sign SignRequestFunc, verify VerifyResponseFunc, logger *zap.Logger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &signingTransport{next: next, sign: sign, verify: verify, logger: logger}
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if req.Body == nil || mediaType != "application/json" {
+		return t.next.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// RoundTrip must not modify the caller's request.
+	req = req.Clone(req.Context())
+	signed, err := t.sign(req.Header, body)
+	if err != nil {
+		return nil, fmt.Errorf("sign eft request: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(signed))
+	req.ContentLength = int64(len(signed))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(signed)), nil
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := t.verify(res.Header, resBody)
+	if err != nil {
+		if unsignedAllowed(res.StatusCode) {
+			res.Body = io.NopCloser(bytes.NewReader(resBody))
+			return res, nil
+		}
+		t.logger.Error("eft response rejected", zap.String("url", req.URL.Path), zap.Int("status", res.StatusCode), zap.Error(err))
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(payload))
+	res.ContentLength = int64(len(payload))
+	res.Header.Set("Content-Length", strconv.Itoa(len(payload)))
+	res.Header.Set("Content-Type", "application/json")
+	return res, nil
+}
+
+// unsignedAllowed lists the answers a gateway sends without a signature. None
+// carries a business payload: a 401 only makes the caller refresh its token.
+func unsignedAllowed(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusUnauthorized
+}
@@ -0,0 +1,154 @@
+package eft
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/cache"
+	"go.uber.org/zap"
+)
+
+func rsaPublicPEM(t *testing.T, key *rsa.PrivateKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Equal(t, nil, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func rsaPrivatePEM(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestSigningTransport(t *testing.T) {
+	merchantKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+	bankKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+	publicPEM := func(key *rsa.PrivateKey) []byte { return rsaPublicPEM(t, key) }
+
+	tests := []struct {
+		name     string
+		mode     string
+		encrypt  bool
+		signWith *rsa.PrivateKey
+		status   int
+		ok       bool
+	}{
+		{name: "detached", mode: SigningDetached, signWith: bankKey, status: http.StatusOK, ok: true},
+		{name: "compact encrypted", mode: SigningCompact, encrypt: true, signWith: bankKey, status: http.StatusOK, ok: true},
+		{name: "wrong bank key", mode: SigningDetached, signWith: otherKey, status: http.StatusOK},
+		{name: "unsigned reject", mode: SigningDetached, status: http.StatusBadRequest},
+		{name: "unsigned 503", mode: SigningDetached, status: http.StatusServiceUnavailable, ok: true},
+		{name: "unsigned 401", mode: SigningDetached, status: http.StatusUnauthorized, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.SigningConfig{Mode: tt.mode, Header: "X-JWS-Signature", Alg: AlgRS256, BankAlg: AlgRS256, BankPublicKey: publicPEM(bankKey), Encrypt: tt.encrypt}
+			// The bank side: the merchant's key verifies requests, the bank's signs answers.
+			bankCfg := cfg
+			bankCfg.BankPublicKey = publicPEM(merchantKey)
+			_, bankVerify, err := JOSESigner(bankCfg, rsaPrivatePEM(bankKey))
+			assert.Equal(t, nil, err)
+			var bankSign SignRequestFunc
+			if tt.signWith != nil {
+				bankSign, _, err = JOSESigner(bankCfg, rsaPrivatePEM(tt.signWith))
+				assert.Equal(t, nil, err)
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				payload, err := bankVerify(r.Header, body)
+				assert.Equal(t, nil, err)
+				assert.Equal(t, `{"merchantTransID":"T1"}`, string(payload))
+
+				answer := []byte(`{"responseCode":"000"}`)
+				if bankSign != nil {
+					answer, err = bankSign(w.Header(), answer)
+					assert.Equal(t, nil, err)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write(answer)
+			}))
+			defer server.Close()
+
+			sign, verify, err := JOSESigner(cfg, rsaPrivatePEM(merchantKey))
+			assert.Equal(t, nil, err)
+			client := &http.Client{Transport: SigningTransport(nil, sign, verify, zap.NewNop())}
+			req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte(`{"merchantTransID":"T1"}`)))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := client.Do(req)
+			assert.Equal(t, tt.ok, err == nil, "err: %v", err)
+			assert.Equal(t, !tt.ok, errors.Is(err, ErrSignatureInvalid))
+			if err == nil {
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				assert.Equal(t, tt.status, res.StatusCode)
+				assert.Equal(t, true, strings.Contains(string(body), `"responseCode":"000"`))
+			}
+		})
+	}
+}
+
+// An expired token gets an unsigned 401 from the gateway; it must reach the
+// caller as ErrUnauthorized so the token is dropped and the call retried.
+func TestSigningTransportUnsigned401(t *testing.T) {
+	merchantKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+	bankKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+
+	cfg := config.SigningConfig{Mode: SigningDetached, Header: "X-JWS-Signature", Alg: AlgRS256, BankAlg: AlgRS256, BankPublicKey: rsaPublicPEM(t, bankKey)}
+	bankCfg := cfg
+	bankCfg.BankPublicKey = rsaPublicPEM(t, merchantKey)
+	bankSign, _, err := JOSESigner(bankCfg, rsaPrivatePEM(bankKey))
+	assert.Equal(t, nil, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_token"}`))
+			return
+		}
+		answer, err := bankSign(w.Header(), []byte(`{"responseCode":"0000","rsTransID":"RS1"}`))
+		assert.Equal(t, nil, err)
+		_, _ = w.Write(answer)
+	}))
+	defer server.Close()
+
+	sign, verify, err := JOSESigner(cfg, rsaPrivatePEM(merchantKey))
+	assert.Equal(t, nil, err)
+	client := &http.Client{Transport: SigningTransport(nil, sign, verify, zap.NewNop())}
+	verifyCall := HTTPVerifyDataFundTransfer(client, server.URL, time.Second, NewRetryPolicy(config.RetryConfig{}))
+
+	redisServer, cmd := newTokenRedis(t)
+	var calls int32
+	var used []string
+	var response *VerifyDataFundTransferResponse
+	err = callWithToken(context.Background(), zap.NewNop(),
+		CachedAccessToken(cmd, tokenConfig, countingOAuth(&calls, 0)),
+		InvalidateCachedAccessToken(cmd),
+		func(accessToken string) (err error) {
+			used = append(used, accessToken)
+			response, err = verifyCall(context.Background(), zap.NewNop(), VerifyDataFundTransferRequest{MerchantTransID: "T1"}, accessToken)
+			return err
+		})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"token-1", "token-2"}, used)
+	assert.Equal(t, "RS1", response.RsTransID)
+	cached, _ := redisServer.Get(cache.FundTransferTokenKey)
+	assert.Equal(t, "token-2", cached)
+}
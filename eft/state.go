@@ -0,0 +1,227 @@
+package eft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	StateInitiated = "INITIATED"
+	StateVerified  = "VERIFIED"
+	StateSubmitted = "SUBMITTED"
+	StateSuccess   = "SUCCESS"
+	StateFailed    = "FAILED"
+	StateUnknown   = "UNKNOWN"
+)
+
+var (
+	ErrTransferNotFound  = errors.New("fund transfer not found")
+	ErrDuplicateTransfer = errors.New("fund transfer already exists")
+	ErrInvalidTransition = errors.New("invalid fund transfer transition")
+)
+
+// transitions lists the allowed next states. SUBMITTED and UNKNOWN may repeat
+// so that intermediate confirm and inquiry responses are recorded too.
+var transitions = map[string][]string{
+	StateInitiated: {StateVerified, StateFailed},
+	StateVerified:  {StateSubmitted, StateFailed},
+	StateSubmitted: {StateSubmitted, StateSuccess, StateFailed, StateUnknown},
+	StateUnknown:   {StateUnknown, StateSuccess, StateFailed},
+}
+
+func CanTransit(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func IsFinalState(state string) bool {
+	return state == StateSuccess || state == StateFailed
+}
+
+type FundTransferRecord struct {
+	MerchantTransID string
+	MerchantID      string
+	RsTransID       string
+	Status          string
+	Amount          Amount
+	ToBankCode      string
+	TransType       string
+	SettlementDate  string
+	FailMsg         string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// Transition moves a transfer to To. Empty RsTransID, SettlementDate and
+// FailMsg keep the stored values. A set From must still be the stored state.
+type Transition struct {
+	MerchantTransID string
+	From            string
+	To              string
+	RsTransID       string
+	SettlementDate  string
+	FailMsg         string
+	Request         interface{}
+	Response        interface{}
+}
+
+type CreateFundTransferFunc func(ctx context.Context, logger *zap.Logger, req VerifyDataFundTransferRequest) error
+
+func CreateFundTransfer(db *pgxpool.Pool) CreateFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, req VerifyDataFundTransferRequest) error {
+		request, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func(tx pgx.Tx) {
+			_ = tx.Rollback(ctx)
+		}(tx)
+
+		sql := `insert into fund_transfer (merchant_trans_id, merchant_id, status, amount, to_bank_code, trans_type)
+				values ($1, $2, $3, $4::numeric, $5, nullif($6, ''))`
+		_, err = tx.Exec(ctx, sql, req.MerchantTransID, req.MerchantID, StateInitiated, req.Amount, req.ToBankCode, req.TransType)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return fmt.Errorf("%w: %s", ErrDuplicateTransfer, req.MerchantTransID)
+			}
+			return err
+		}
+
+		sql = `insert into fund_transfer_transition (merchant_trans_id, from_status, to_status, request) values ($1, null, $2, $3)`
+		if _, err = tx.Exec(ctx, sql, req.MerchantTransID, StateInitiated, request); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+}
+
+type TransitFundTransferFunc func(ctx context.Context, logger *zap.Logger, transition Transition) error
+
+func TransitFundTransfer(db *pgxpool.Pool) TransitFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, transition Transition) error {
+		request, err := marshalNullable(transition.Request)
+		if err != nil {
+			return err
+		}
+		response, err := marshalNullable(transition.Response)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func(tx pgx.Tx) {
+			_ = tx.Rollback(ctx)
+		}(tx)
+
+		var from string
+		sql := `select status from fund_transfer where merchant_trans_id = $1 for update`
+		err = tx.QueryRow(ctx, sql, transition.MerchantTransID).Scan(&from)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: %s", ErrTransferNotFound, transition.MerchantTransID)
+			}
+			return err
+		}
+		if !CanTransit(from, transition.To) || (transition.From != "" && transition.From != from) {
+			return fmt.Errorf("%w: %s from %s to %s", ErrInvalidTransition, transition.MerchantTransID, from, transition.To)
+		}
+
+		sql = `update fund_transfer
+				set status          = $2,
+					rs_trans_id     = coalesce(nullif($3, ''), rs_trans_id),
+					settlement_date = coalesce(nullif($4, ''), settlement_date),
+					fail_msg        = coalesce(nullif($5, ''), fail_msg),
+					updated_at      = now()
+				where merchant_trans_id = $1`
+		_, err = tx.Exec(ctx, sql, transition.MerchantTransID, transition.To, transition.RsTransID, transition.SettlementDate, transition.FailMsg)
+		if err != nil {
+			return err
+		}
+
+		sql = `insert into fund_transfer_transition (merchant_trans_id, from_status, to_status, request, response) values ($1, $2, $3, $4, $5)`
+		_, err = tx.Exec(ctx, sql, transition.MerchantTransID, from, transition.To, request, response)
+		if err != nil {
+			return err
+		}
+		if err = insertOutboxEvent(ctx, tx, transition.MerchantTransID, from, transition.To); err != nil {
+			return err
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			return err
+		}
+		logger.Info("fund transfer transition",
+			zap.String("merchantTransID", transition.MerchantTransID),
+			zap.String("from", from),
+			zap.String("to", transition.To),
+		)
+		return nil
+	}
+}
+
+type GetFundTransferFunc func(ctx context.Context, logger *zap.Logger, merchantTransID string) (*FundTransferRecord, error)
+
+// fundTransferRecordColumns is the select list read by scanFundTransferRecord,
+// shared so every query fills a FundTransferRecord the same way.
+const fundTransferRecordColumns = `merchant_trans_id, merchant_id, coalesce(rs_trans_id, ''), status, coalesce(amount, 0)::text,
+				coalesce(to_bank_code, ''), coalesce(trans_type, ''), coalesce(settlement_date, ''), coalesce(fail_msg, ''), created_at, updated_at`
+
+func scanFundTransferRecord(row pgx.Row, record *FundTransferRecord) error {
+	return row.Scan(
+		&record.MerchantTransID,
+		&record.MerchantID,
+		&record.RsTransID,
+		&record.Status,
+		&record.Amount,
+		&record.ToBankCode,
+		&record.TransType,
+		&record.SettlementDate,
+		&record.FailMsg,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+	)
+}
+
+func GetFundTransfer(db *pgxpool.Pool) GetFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, merchantTransID string) (*FundTransferRecord, error) {
+		sql := `select ` + fundTransferRecordColumns + `
+				from fund_transfer where merchant_trans_id = $1`
+		var record FundTransferRecord
+		err := scanFundTransferRecord(db.QueryRow(ctx, sql, merchantTransID), &record)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("%w: %s", ErrTransferNotFound, merchantTransID)
+			}
+			return nil, err
+		}
+		return &record, nil
+	}
+}
+
+func marshalNullable(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,363 @@
+package eft
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/sftp"
+	"go.uber.org/zap"
+)
+
+const (
+	BucketMatched         = "MATCHED"
+	BucketMissingOurSide  = "MISSING_OUR_SIDE"
+	BucketMissingBankSide = "MISSING_BANK_SIDE"
+	BucketAmountMismatch  = "AMOUNT_MISMATCH"
+)
+
+var ErrStatementMismatch = errors.New("bank statement does not match fund transfers")
+
+// StatementLine is one settled transfer in the bank's statement file.
+type StatementLine struct {
+	Line            int
+	RsTransID       string
+	MerchantTransID string
+	Amount          Amount
+}
+
+// StatementItem is a statement line, a recorded transfer, or both.
+type StatementItem struct {
+	MerchantTransID string  `json:"merchantTransID"`
+	RsTransID       string  `json:"rsTransID"`
+	OurStatus       string  `json:"ourStatus,omitempty"`
+	OurAmount       *Amount `json:"ourAmount,omitempty"`
+	BankAmount      *Amount `json:"bankAmount,omitempty"`
+}
+
+type StatementReport struct {
+	SettlementDate  string          `json:"settlementDate"`
+	GeneratedAt     time.Time       `json:"generatedAt"`
+	BankLines       int             `json:"bankLines"`
+	Transfers       int             `json:"transfers"`
+	Matched         []StatementItem `json:"matched"`
+	MissingOurSide  []StatementItem `json:"missingOurSide"`
+	MissingBankSide []StatementItem `json:"missingBankSide"`
+	AmountMismatch  []StatementItem `json:"amountMismatch"`
+	OK              bool            `json:"ok"`
+}
+
+// Buckets returns the report items keyed by bucket name.
+func (r StatementReport) Buckets() map[string][]StatementItem {
+	return map[string][]StatementItem{
+		BucketMatched:         r.Matched,
+		BucketMissingOurSide:  r.MissingOurSide,
+		BucketMissingBankSide: r.MissingBankSide,
+		BucketAmountMismatch:  r.AmountMismatch,
+	}
+}
+
+// ParseStatement reads a delimited statement file with a header row. Columns
+// are found by name (rsTransID, merchantTransID, amount), case-insensitively.
+func ParseStatement(data []byte, delimiter rune) ([]StatementLine, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("statement header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"rstransid", "merchanttransid", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("statement header has no %s column", name)
+		}
+	}
+
+	var lines []StatementLine
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("statement line %d: %w", line, err)
+		}
+		field := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		amount, err := NewAmount(field("amount"))
+		if err != nil {
+			return nil, fmt.Errorf("statement line %d: %w", line, err)
+		}
+		lines = append(lines, StatementLine{
+			Line:            line,
+			RsTransID:       field("rstransid"),
+			MerchantTransID: field("merchanttransid"),
+			Amount:          amount,
+		})
+	}
+}
+
+// MatchStatement buckets statement lines against recorded transfers. A line
+// matches by RsTransID, else MerchantTransID, and must be SUCCESS with the
+// same amount; recorded SUCCESS transfers for the date with no line are
+// missing on the bank side.
+func MatchStatement(settlementDate string, lines []StatementLine, records []FundTransferRecord) *StatementReport {
+	report := &StatementReport{
+		SettlementDate:  settlementDate,
+		GeneratedAt:     time.Now(),
+		BankLines:       len(lines),
+		Transfers:       len(records),
+		Matched:         []StatementItem{},
+		MissingOurSide:  []StatementItem{},
+		MissingBankSide: []StatementItem{},
+		AmountMismatch:  []StatementItem{},
+	}
+
+	byRsTransID := map[string]int{}
+	byMerchantTransID := map[string]int{}
+	for i, record := range records {
+		if record.RsTransID != "" {
+			byRsTransID[record.RsTransID] = i
+		}
+		byMerchantTransID[record.MerchantTransID] = i
+	}
+
+	seen := map[int]bool{}
+	for _, line := range lines {
+		line := line
+		item := StatementItem{MerchantTransID: line.MerchantTransID, RsTransID: line.RsTransID, BankAmount: &line.Amount}
+		i, ok := byRsTransID[line.RsTransID]
+		if !ok || line.RsTransID == "" {
+			i, ok = byMerchantTransID[line.MerchantTransID]
+		}
+		if !ok {
+			report.MissingOurSide = append(report.MissingOurSide, item)
+			continue
+		}
+		seen[i] = true
+		record := records[i]
+		item.MerchantTransID = record.MerchantTransID
+		item.RsTransID = record.RsTransID
+		item.OurStatus = record.Status
+		item.OurAmount = &record.Amount
+
+		switch {
+		case record.Status != StateSuccess:
+			report.MissingOurSide = append(report.MissingOurSide, item)
+		case !record.Amount.Equal(line.Amount):
+			report.AmountMismatch = append(report.AmountMismatch, item)
+		default:
+			report.Matched = append(report.Matched, item)
+		}
+	}
+
+	for i, record := range records {
+		if seen[i] || record.Status != StateSuccess || record.SettlementDate != settlementDate {
+			continue
+		}
+		report.MissingBankSide = append(report.MissingBankSide, StatementItem{
+			MerchantTransID: record.MerchantTransID,
+			RsTransID:       record.RsTransID,
+			OurStatus:       record.Status,
+			OurAmount:       &records[i].Amount,
+		})
+	}
+
+	report.OK = len(report.MissingOurSide) == 0 && len(report.MissingBankSide) == 0 && len(report.AmountMismatch) == 0
+	return report
+}
+
+type GetStatementFunc func(ctx context.Context, logger *zap.Logger, settlementDate string) ([]byte, error)
+
+// DownloadStatement fetches cfg.Path, with %s replaced by the settlement date.
+func DownloadStatement(client *sftp.Client, cfg config.StatementConfig) GetStatementFunc {
+	return func(ctx context.Context, logger *zap.Logger, settlementDate string) ([]byte, error) {
+		path := fmt.Sprintf(cfg.Path, settlementDate)
+		data, err := client.Download(path)
+		if err != nil {
+			return nil, fmt.Errorf("download statement %s: %w", path, err)
+		}
+		logger.Info("statement downloaded", zap.String("path", path), zap.Int("size", len(data)))
+		return data, nil
+	}
+}
+
+type ListSettledTransfersFunc func(ctx context.Context, logger *zap.Logger, settlementDate string, lines []StatementLine) ([]FundTransferRecord, error)
+
+// ListSettledTransfers returns transfers settled on settlementDate plus any
+// transfer the statement lines refer to, whatever its state.
+func ListSettledTransfers(db *pgxpool.Pool) ListSettledTransfersFunc {
+	return func(ctx context.Context, logger *zap.Logger, settlementDate string, lines []StatementLine) ([]FundTransferRecord, error) {
+		rsTransIDs := make([]string, 0, len(lines))
+		merchantTransIDs := make([]string, 0, len(lines))
+		for _, line := range lines {
+			rsTransIDs = append(rsTransIDs, line.RsTransID)
+			merchantTransIDs = append(merchantTransIDs, line.MerchantTransID)
+		}
+
+		sql := `select merchant_trans_id, merchant_id, coalesce(rs_trans_id, ''), status, amount::text,
+				coalesce(to_bank_code, ''), coalesce(settlement_date, ''), coalesce(fail_msg, ''), created_at, updated_at
+				from fund_transfer
+				where (settlement_date = $1 and status = $2)
+				   or rs_trans_id = any($3)
+				   or merchant_trans_id = any($4)`
+		rows, err := db.Query(ctx, sql, settlementDate, StateSuccess, rsTransIDs, merchantTransIDs)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var records []FundTransferRecord
+		for rows.Next() {
+			var record FundTransferRecord
+			err := rows.Scan(
+				&record.MerchantTransID,
+				&record.MerchantID,
+				&record.RsTransID,
+				&record.Status,
+				&record.Amount,
+				&record.ToBankCode,
+				&record.SettlementDate,
+				&record.FailMsg,
+				&record.CreatedAt,
+				&record.UpdatedAt,
+			)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		return records, rows.Err()
+	}
+}
+
+type PublishStatementReportFunc func(ctx context.Context, logger *zap.Logger, report StatementReport) error
+
+// InsertStatementReport replaces the stored buckets for the report's date.
+func InsertStatementReport(db *pgxpool.Pool) PublishStatementReportFunc {
+	return func(ctx context.Context, logger *zap.Logger, report StatementReport) error {
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func(tx pgx.Tx) {
+			_ = tx.Rollback(ctx)
+		}(tx)
+
+		sql := `delete from fund_transfer_statement_recon where settlement_date = $1`
+		if _, err = tx.Exec(ctx, sql, report.SettlementDate); err != nil {
+			return err
+		}
+
+		batch := &pgx.Batch{}
+		sql = `insert into fund_transfer_statement_recon (settlement_date, bucket, merchant_trans_id, rs_trans_id, our_status, our_amount, bank_amount)
+				values ($1, $2, nullif($3, ''), nullif($4, ''), nullif($5, ''), $6::numeric, $7::numeric)`
+		for bucket, items := range report.Buckets() {
+			for _, item := range items {
+				batch.Queue(sql, report.SettlementDate, bucket, item.MerchantTransID, item.RsTransID, item.OurStatus, item.OurAmount, item.BankAmount)
+			}
+		}
+		if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+}
+
+func PutStatementReportToS3(svc *s3.S3, bucket string, cfg config.StatementConfig) PublishStatementReportFunc {
+	return func(ctx context.Context, logger *zap.Logger, report StatementReport) error {
+		body, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf(cfg.ReportKey, report.SettlementDate)
+		_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      &bucket,
+			Key:         &key,
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info("statement report written", zap.String("key", key))
+		return nil
+	}
+}
+
+type ReconcileStatementFunc func(ctx context.Context, logger *zap.Logger, settlementDate string) (*StatementReport, error)
+
+// ReconcileStatement returns ErrStatementMismatch once the report has been
+// published if any line or transfer fell outside the matched bucket.
+func ReconcileStatement(
+	cfg config.StatementConfig,
+	GetStatementFunc GetStatementFunc,
+	ListSettledTransfersFunc ListSettledTransfersFunc,
+	PublishStatementReportFuncs ...PublishStatementReportFunc,
+) ReconcileStatementFunc {
+	return func(ctx context.Context, logger *zap.Logger, settlementDate string) (*StatementReport, error) {
+		logger = logger.With(zap.String("settlementDate", settlementDate))
+
+		data, err := GetStatementFunc(ctx, logger, settlementDate)
+		if err != nil {
+			logger.Error("Error GetStatementFunc", zap.Error(err))
+			return nil, err
+		}
+		delimiter := ','
+		if cfg.Delimiter != "" {
+			delimiter = []rune(cfg.Delimiter)[0]
+		}
+		lines, err := ParseStatement(data, delimiter)
+		if err != nil {
+			logger.Error("Error ParseStatement", zap.Error(err))
+			return nil, err
+		}
+		records, err := ListSettledTransfersFunc(ctx, logger, settlementDate, lines)
+		if err != nil {
+			logger.Error("Error ListSettledTransfersFunc", zap.Error(err))
+			return nil, err
+		}
+
+		report := MatchStatement(settlementDate, lines, records)
+		logger.Info("statement reconciled",
+			zap.Int("bankLines", report.BankLines),
+			zap.Int("transfers", report.Transfers),
+			zap.Int("matched", len(report.Matched)),
+			zap.Int("missingOurSide", len(report.MissingOurSide)),
+			zap.Int("missingBankSide", len(report.MissingBankSide)),
+			zap.Int("amountMismatch", len(report.AmountMismatch)),
+		)
+
+		for _, publish := range PublishStatementReportFuncs {
+			if err := publish(ctx, logger, *report); err != nil {
+				logger.Error("Error PublishStatementReportFunc", zap.Error(err))
+				return report, err
+			}
+		}
+		if !report.OK {
+			return report, ErrStatementMismatch
+		}
+		return report, nil
+	}
+}
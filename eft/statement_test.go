@@ -0,0 +1,44 @@
+package eft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchStatement(t *testing.T) {
+	lines, err := ParseStatement([]byte(
+		"RsTransID,MerchantTransID,Amount\n"+
+			"RS1,M1,100.00\n"+
+			"RS2,M2,\"1,250.50\"\n"+
+			",M3,10\n"+
+			"RS9,M9,5\n",
+	), ',')
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(lines))
+	assert.Equal(t, "1250.50", lines[1].Amount.String())
+
+	records := []FundTransferRecord{
+		{MerchantTransID: "M1", RsTransID: "RS1", Status: StateSuccess, Amount: MustAmount("100"), SettlementDate: "20240410"},
+		{MerchantTransID: "M2", RsTransID: "RS2", Status: StateSuccess, Amount: MustAmount("1250.00"), SettlementDate: "20240410"},
+		{MerchantTransID: "M3", RsTransID: "RS3", Status: StateUnknown, Amount: MustAmount("10.00")},
+		{MerchantTransID: "M4", RsTransID: "RS4", Status: StateSuccess, Amount: MustAmount("7.00"), SettlementDate: "20240410"},
+	}
+	report := MatchStatement("20240410", lines, records)
+
+	ids := func(items []StatementItem) []string {
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.MerchantTransID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"M1"}, ids(report.Matched))
+	assert.Equal(t, []string{"M2"}, ids(report.AmountMismatch))
+	assert.Equal(t, []string{"M3", "M9"}, ids(report.MissingOurSide))
+	assert.Equal(t, []string{"M4"}, ids(report.MissingBankSide))
+	assert.Equal(t, false, report.OK)
+
+	_, err = ParseStatement([]byte("merchantTransID,amount\nM1,1\n"), ',')
+	assert.EqualError(t, err, "statement header has no rstransid column")
+}
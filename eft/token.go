@@ -0,0 +1,154 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/cache"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const tokenPollInterval = 100 * time.Millisecond
+
+// GetAccessTokenFunc returns a bearer access token for the EFT gateway.
+type GetAccessTokenFunc func(ctx context.Context, logger *zap.Logger) (string, error)
+
+// InvalidateAccessTokenFunc drops a token the bank rejected with 401.
+type InvalidateAccessTokenFunc func(ctx context.Context, logger *zap.Logger, accessToken string) error
+
+// TokenTTL is the cache lifetime of a token: ExpiresIn minus margin.
+func TokenTTL(token *AccessTokenResponse, margin time.Duration) (time.Duration, error) {
+	seconds, err := strconv.Atoi(token.ExpiresIn)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expires_in %q: %w", token.ExpiresIn, err)
+	}
+	return time.Duration(seconds)*time.Second - margin, nil
+}
+
+// DirectAccessToken calls the OAuth endpoint every time, for callers without Redis.
+func DirectAccessToken(cfg config.EFTConfig, HTTPOauthFundTransferHttpFunc HTTPOauthFundTransferHttpFunc) GetAccessTokenFunc {
+	return func(ctx context.Context, logger *zap.Logger) (string, error) {
+		token, err := HTTPOauthFundTransferHttpFunc(ctx, logger, cfg.BasicAuth)
+		if err != nil {
+			return "", err
+		}
+		return token.AccessToken, nil
+	}
+}
+
+func NoopInvalidateAccessToken() InvalidateAccessTokenFunc {
+	return func(ctx context.Context, logger *zap.Logger, accessToken string) error {
+		return nil
+	}
+}
+
+// CachedAccessToken shares one token across workers through Redis. Within a
+// process concurrent callers share one refresh; across processes the refresh
+// is guarded by a Redis lock and the losers wait for the winner's token.
+func CachedAccessToken(cmd redis.Cmdable, cfg config.EFTConfig, HTTPOauthFundTransferHttpFunc HTTPOauthFundTransferHttpFunc) GetAccessTokenFunc {
+	getRedis := cache.GetRedis(cmd)
+	setRedis := cache.SetRedis(cmd)
+	trySetNX := cache.TrySetRedisNX(cmd)
+	compareAndDelete := cache.CompareAndDeleteRedis(cmd)
+	inCr := cache.InCrRedis(cmd)
+	setExpire := cache.SetExpire(cmd)
+	group := &singleflight.Group{}
+
+	cached := func(ctx context.Context) (string, error) {
+		token, err := getRedis(ctx, cache.FundTransferTokenKey)
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		return token, err
+	}
+
+	refresh := func(ctx context.Context, logger *zap.Logger) (string, error) {
+		owner := uuid.NewString()
+		locked, err := trySetNX(ctx, cache.FundTransferTokenLockKey, owner, cfg.TokenLockTTL)
+		if err != nil {
+			return "", err
+		}
+
+		if !locked {
+			deadline := time.Now().Add(cfg.TokenLockTTL)
+			for time.Now().Before(deadline) {
+				if err := sleep(ctx, tokenPollInterval); err != nil {
+					return "", err
+				}
+				if token, err := cached(ctx); err != nil || token != "" {
+					return token, err
+				}
+			}
+			logger.Warn("timed out waiting for token refresh lock, fetching token directly")
+		} else {
+			defer func() {
+				if err := compareAndDelete(ctx, cache.FundTransferTokenLockKey, owner); err != nil {
+					logger.Error("Error release token lock", zap.Error(err))
+				}
+			}()
+			if token, err := cached(ctx); err != nil || token != "" {
+				return token, err
+			}
+		}
+
+		token, err := HTTPOauthFundTransferHttpFunc(ctx, logger, cfg.BasicAuth)
+		if err != nil {
+			return "", err
+		}
+
+		countKey := fmt.Sprintf(cache.OAuthCountKey, time.Now().Format("20060102"))
+		if _, err := inCr(ctx, countKey); err == nil {
+			_ = setExpire(ctx, countKey, 48*time.Hour)
+		}
+
+		ttl, err := TokenTTL(token, cfg.TokenSafetyMargin)
+		if err != nil {
+			logger.Warn("access token not cached", zap.Error(err))
+			return token.AccessToken, nil
+		}
+		if ttl <= 0 {
+			logger.Warn("access token expires within safety margin, not cached", zap.String("expiresIn", token.ExpiresIn))
+			return token.AccessToken, nil
+		}
+		if err := setRedis(ctx, cache.FundTransferTokenKey, token.AccessToken, ttl); err != nil {
+			logger.Error("Error cache access token", zap.Error(err))
+		}
+		logger.Info("access token refreshed", zap.Duration("ttl", ttl))
+		return token.AccessToken, nil
+	}
+
+	return func(ctx context.Context, logger *zap.Logger) (string, error) {
+		token, err := cached(ctx)
+		if err != nil {
+			logger.Warn("Error read cached access token", zap.Error(err))
+		}
+		if token != "" {
+			return token, nil
+		}
+
+		v, err, _ := group.Do(cache.FundTransferTokenKey, func() (interface{}, error) {
+			return refresh(ctx, logger)
+		})
+		if err != nil {
+			return "", err
+		}
+		return v.(string), nil
+	}
+}
+
+// InvalidateCachedAccessToken deletes the cached token only if it is still
+// the rejected one, so a token refreshed meanwhile by another worker survives.
+func InvalidateCachedAccessToken(cmd redis.Cmdable) InvalidateAccessTokenFunc {
+	compareAndDelete := cache.CompareAndDeleteRedis(cmd)
+	return func(ctx context.Context, logger *zap.Logger, accessToken string) error {
+		logger.Warn("invalidating cached access token")
+		return compareAndDelete(ctx, cache.FundTransferTokenKey, accessToken)
+	}
+}
@@ -0,0 +1,102 @@
+package eft
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/cache"
+	"go.uber.org/zap"
+)
+
+func newTokenRedis(t *testing.T) (*miniredis.Miniredis, redis.Cmdable) {
+	server := miniredis.RunT(t)
+	return server, redis.NewClient(&redis.Options{Addr: server.Addr()})
+}
+
+// countingOAuth hands out token-1, token-2, ... after delay.
+func countingOAuth(calls *int32, delay time.Duration) HTTPOauthFundTransferHttpFunc {
+	return func(ctx context.Context, logger *zap.Logger, auth string) (*AccessTokenResponse, error) {
+		n := atomic.AddInt32(calls, 1)
+		time.Sleep(delay)
+		return &AccessTokenResponse{AccessToken: fmt.Sprintf("token-%d", n), ExpiresIn: "1799", Status: OauthSuccess}, nil
+	}
+}
+
+var tokenConfig = config.EFTConfig{TokenSafetyMargin: time.Minute, TokenLockTTL: 2 * time.Second}
+
+func TestCachedAccessTokenSingleFlight(t *testing.T) {
+	server, cmd := newTokenRedis(t)
+	var calls int32
+	oauth := countingOAuth(&calls, 50*time.Millisecond)
+
+	// Two processes, each with callers of its own, share one refresh: the
+	// lock winner fetches and the losers pick up its cached token.
+	processes := []GetAccessTokenFunc{CachedAccessToken(cmd, tokenConfig, oauth), CachedAccessToken(cmd, tokenConfig, oauth)}
+	tokens := make([]string, 6)
+	var wg sync.WaitGroup
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := processes[i%2](context.Background(), zap.NewNop())
+			assert.Equal(t, nil, err)
+			tokens[i] = token
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+	for _, token := range tokens {
+		assert.Equal(t, "token-1", token)
+	}
+	assert.Equal(t, 28*time.Minute+59*time.Second, server.TTL(cache.FundTransferTokenKey))
+	assert.Equal(t, false, server.Exists(cache.FundTransferTokenLockKey))
+}
+
+func TestCachedAccessTokenWaitsForLockHolder(t *testing.T) {
+	server, cmd := newTokenRedis(t)
+	assert.Equal(t, nil, server.Set(cache.FundTransferTokenLockKey, "other-process"))
+	go func() {
+		time.Sleep(3 * tokenPollInterval)
+		_ = server.Set(cache.FundTransferTokenKey, "token-other")
+	}()
+
+	var calls int32
+	token, err := CachedAccessToken(cmd, tokenConfig, countingOAuth(&calls, 0))(context.Background(), zap.NewNop())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "token-other", token)
+	assert.Equal(t, int32(0), calls)
+}
+
+func TestInvalidateCachedAccessTokenOn401(t *testing.T) {
+	server, cmd := newTokenRedis(t)
+	var calls int32
+	getToken := CachedAccessToken(cmd, tokenConfig, countingOAuth(&calls, 0))
+	invalidate := InvalidateCachedAccessToken(cmd)
+
+	var used []string
+	err := callWithToken(context.Background(), zap.NewNop(), getToken, invalidate, func(accessToken string) error {
+		used = append(used, accessToken)
+		if accessToken == "token-1" {
+			return ErrUnauthorized
+		}
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"token-1", "token-2"}, used)
+	cached, _ := server.Get(cache.FundTransferTokenKey)
+	assert.Equal(t, "token-2", cached)
+
+	// A late 401 for the old token leaves the fresh one alone.
+	assert.Equal(t, nil, invalidate(context.Background(), zap.NewNop(), "token-1"))
+	cached, _ = server.Get(cache.FundTransferTokenKey)
+	assert.Equal(t, "token-2", cached)
+}
@@ -0,0 +1,217 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+const (
+	TxnStatusSuccess   = "Success"
+	TxnStatusFail      = "Fail"
+	TxnStatusInProcess = "In Process"
+)
+
+type TransferRequest struct {
+	VerifyDataFundTransferRequest
+	CustomerMobileNo string
+}
+
+// TransferResult carries the final state plus every bank response seen on
+// the way, so callers can persist or reconcile them.
+type TransferResult struct {
+	MerchantTransID string
+	RsTransID       string
+	Status          string
+	SettlementDate  string
+	FailMsg         string
+	// Reason is the gateway error behind a FAILED or UNKNOWN result.
+	Reason    *GatewayError
+	Verify    *VerifyDataFundTransferResponse
+	Confirm   *FundTransferResponse
+	Inquiries []*InquiryStatusResponse
+}
+
+// TransferFunc returns an error only when the outcome could not be settled.
+// A bank rejection is a FAILED result with a nil error.
+type TransferFunc func(ctx context.Context, logger *zap.Logger, req TransferRequest) (*TransferResult, error)
+
+// Transfer runs the whole flow and records every state change through
+// CreateFundTransferFunc and TransitFundTransferFunc before moving on, so a
+// crash between confirm and inquiry leaves the transfer in SUBMITTED.
+func Transfer(
+	cfg config.EFTConfig,
+	GetAccessTokenFunc GetAccessTokenFunc,
+	InvalidateAccessTokenFunc InvalidateAccessTokenFunc,
+	HTTPVerifyDataFundTransferFunc HTTPVerifyDataFundTransferFunc,
+	HTTPFundTransferFunc HTTPFundTransferFunc,
+	HTTPInquiryStatusFundTransferFunc HTTPInquiryStatusFundTransferFunc,
+	CreateFundTransferFunc CreateFundTransferFunc,
+	TransitFundTransferFunc TransitFundTransferFunc,
+) TransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, req TransferRequest) (*TransferResult, error) {
+		if req.MerchantID == "" {
+			req.MerchantID = cfg.MerchantID
+		}
+		if req.RequestDateTime == "" {
+			req.RequestDateTime = time.Now().Format(time.RFC3339)
+		}
+		logger = logger.With(zap.String("merchantTransID", req.MerchantTransID))
+		result := &TransferResult{MerchantTransID: req.MerchantTransID, Status: StateInitiated}
+
+		transit := func(transition Transition) error {
+			transition.MerchantTransID = req.MerchantTransID
+			if err := TransitFundTransferFunc(ctx, logger, transition); err != nil {
+				logger.Error("Error TransitFundTransferFunc", zap.String("to", transition.To), zap.Error(err))
+				return err
+			}
+			result.Status = transition.To
+			return nil
+		}
+		fail := func(msg string, request, response interface{}) error {
+			result.FailMsg = msg
+			return transit(Transition{To: StateFailed, FailMsg: msg, Request: request, Response: response})
+		}
+
+		withToken := func(call func(accessToken string) error) error {
+			return callWithToken(ctx, logger, GetAccessTokenFunc, InvalidateAccessTokenFunc, call)
+		}
+
+		if err := req.Amount.Validate(); err != nil {
+			return nil, err
+		}
+		if err := CreateFundTransferFunc(ctx, logger, req.VerifyDataFundTransferRequest); err != nil {
+			logger.Error("Error CreateFundTransferFunc", zap.Error(err))
+			return nil, err
+		}
+
+		var verify *VerifyDataFundTransferResponse
+		err := withToken(func(accessToken string) (err error) {
+			verify, err = HTTPVerifyDataFundTransferFunc(ctx, logger, req.VerifyDataFundTransferRequest, accessToken)
+			return err
+		})
+		if err != nil {
+			logger.Error("Error HTTPVerifyDataFundTransferFunc", zap.Error(err))
+			errors.As(err, &result.Reason)
+			if tErr := fail(err.Error(), req.VerifyDataFundTransferRequest, nil); tErr != nil {
+				return result, tErr
+			}
+			return result, err
+		}
+		result.Verify = verify
+		result.RsTransID = verify.RsTransID
+		if err := verify.Err(); err != nil {
+			errors.As(err, &result.Reason)
+			logger.Warn("verify rejected", zap.String("kind", string(result.Reason.Kind)), zap.String("responseCode", verify.ResponseCode), zap.String("responseMsg", verify.ResponseMsg))
+			return result, fail(verify.ResponseMsg, req.VerifyDataFundTransferRequest, verify)
+		}
+		if err := checkAmount(req.Amount, verify.Amount); err != nil {
+			logger.Error("verify amount mismatch", zap.Error(err))
+			return result, fail(err.Error(), req.VerifyDataFundTransferRequest, verify)
+		}
+		err = transit(Transition{To: StateVerified, RsTransID: verify.RsTransID, Request: req.VerifyDataFundTransferRequest, Response: verify})
+		if err != nil {
+			return result, err
+		}
+
+		confirmReq := FundTransferRequest{
+			MerchantID:       req.MerchantID,
+			RequestDateTime:  time.Now().Format(time.RFC3339),
+			MerchantTransID:  req.MerchantTransID,
+			RsTransID:        verify.RsTransID,
+			CustomerMobileNo: req.CustomerMobileNo,
+		}
+		if err := transit(Transition{To: StateSubmitted, Request: confirmReq}); err != nil {
+			return result, err
+		}
+
+		var confirm *FundTransferResponse
+		err = withToken(func(accessToken string) (err error) {
+			confirm, err = HTTPFundTransferFunc(ctx, logger, confirmReq, accessToken)
+			return err
+		})
+		result.Confirm = confirm
+		if err == nil {
+			err = confirm.Err()
+		}
+		var gwErr *GatewayError
+		switch {
+		case err == nil:
+			result.SettlementDate = confirm.SettlementDate
+			err = transit(Transition{To: StateSubmitted, SettlementDate: confirm.SettlementDate, Response: confirm})
+		case errors.As(err, &gwErr) && gwErr.Final:
+			result.Reason = gwErr
+			logger.Warn("confirm rejected", zap.String("kind", string(gwErr.Kind)), zap.Error(err))
+			msg := gwErr.Message
+			if msg == "" {
+				msg = err.Error()
+			}
+			return result, fail(msg, confirmReq, confirm)
+		case errors.Is(err, ErrCircuitOpen):
+			// The breaker stopped the confirm before it left, so the bank
+			// never saw it and failing is safe.
+			logger.Warn("confirm not sent", zap.Error(err))
+			return result, fail(err.Error(), confirmReq, nil)
+		case confirm != nil:
+			// The bank answered without settling it, so resolve it by inquiry.
+			result.Reason = gwErr
+			logger.Warn("confirm unresolved, resolving by inquiry", zap.Error(err))
+			err = transit(Transition{To: StateSubmitted, Response: confirm})
+		default:
+			// The bank may still have taken the transfer, so resolve it by inquiry.
+			result.Reason = gwErr
+			logger.Error("Error HTTPFundTransferFunc, resolving by inquiry", zap.Error(err))
+			err = nil
+		}
+		if err != nil {
+			return result, err
+		}
+
+		inquiryReq := InquiryStatusRequest{
+			MerchantID:      req.MerchantID,
+			MerchantTransID: req.MerchantTransID,
+			RsTransID:       verify.RsTransID,
+		}
+		var lastInquiry *InquiryStatusResponse
+		for i := 0; i < cfg.MaxInquiry; i++ {
+			if i > 0 {
+				if err := sleep(ctx, cfg.InquiryInterval); err != nil {
+					// Leave the transfer in SUBMITTED; ResolveTransfer picks it up later.
+					logger.Warn("inquiry interrupted", zap.Error(err))
+					return result, err
+				}
+			}
+			inquiryReq.RequestDateTime = time.Now().Format(time.RFC3339)
+			var inquiry *InquiryStatusResponse
+			err := withToken(func(accessToken string) (err error) {
+				inquiry, err = HTTPInquiryStatusFundTransferFunc(ctx, logger, inquiryReq, fmt.Sprintf("Bearer %s", accessToken))
+				return err
+			})
+			if err != nil {
+				logger.Error("Error HTTPInquiryStatusFundTransferFunc", zap.Error(err))
+				continue
+			}
+			result.Inquiries = append(result.Inquiries, inquiry)
+			lastInquiry = inquiry
+
+			switch inquiry.TxnStatus {
+			case TxnStatusSuccess:
+				result.SettlementDate = inquiry.SettlementDate
+				return result, transit(Transition{To: StateSuccess, SettlementDate: inquiry.SettlementDate, Request: inquiryReq, Response: inquiry})
+			case TxnStatusFail:
+				result.Reason = newGatewayError(KindBusinessReject, inquiry.ResponseCode, inquiry.FailMsg, nil)
+				return result, fail(inquiry.FailMsg, inquiryReq, inquiry)
+			}
+			logger.Info("transfer still in process", zap.Int("inquiry", i+1), zap.String("txnStatus", inquiry.TxnStatus))
+		}
+
+		if err := transit(Transition{To: StateUnknown, Request: inquiryReq, Response: lastInquiry}); err != nil {
+			return result, err
+		}
+		return result, fmt.Errorf("transfer %s still unresolved after %d inquiries", req.MerchantTransID, cfg.MaxInquiry)
+	}
+}
@@ -0,0 +1,249 @@
+package eft_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft/mockbank"
+	"go.uber.org/zap"
+)
+
+// memoryStore keeps transfer states in memory, enforcing the same transitions
+// as the PostgreSQL store.
+type memoryStore struct {
+	mu        sync.Mutex
+	states    map[string][]string
+	updatedAt map[string]time.Time
+}
+
+// touch must be called with m.mu held.
+func (m *memoryStore) touch(merchantTransID string) {
+	if m.updatedAt == nil {
+		m.updatedAt = map[string]time.Time{}
+	}
+	m.updatedAt[merchantTransID] = time.Now()
+}
+
+func (m *memoryStore) create() eft.CreateFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, req eft.VerifyDataFundTransferRequest) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.states[req.MerchantTransID]; ok {
+			return eft.ErrDuplicateTransfer
+		}
+		m.states[req.MerchantTransID] = []string{eft.StateInitiated}
+		m.touch(req.MerchantTransID)
+		return nil
+	}
+}
+
+func (m *memoryStore) transit() eft.TransitFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, transition eft.Transition) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		states := m.states[transition.MerchantTransID]
+		from := states[len(states)-1]
+		if !eft.CanTransit(from, transition.To) || (transition.From != "" && transition.From != from) {
+			return eft.ErrInvalidTransition
+		}
+		m.states[transition.MerchantTransID] = append(states, transition.To)
+		m.touch(transition.MerchantTransID)
+		return nil
+	}
+}
+
+func (m *memoryStore) get() eft.GetFundTransferFunc {
+	return func(ctx context.Context, logger *zap.Logger, merchantTransID string) (*eft.FundTransferRecord, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		states, ok := m.states[merchantTransID]
+		if !ok {
+			return nil, eft.ErrTransferNotFound
+		}
+		return &eft.FundTransferRecord{
+			MerchantTransID: merchantTransID,
+			Status:          states[len(states)-1],
+			UpdatedAt:       m.updatedAt[merchantTransID],
+		}, nil
+	}
+}
+
+// lostResponse lets requests for path reach the bank but drops the answer,
+// as a connection reset after the bank took the request would.
+type lostResponse struct {
+	next http.RoundTripper
+	path string
+}
+
+func (l lostResponse) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := l.next.RoundTrip(req)
+	if err == nil && req.URL.Path == l.path {
+		res.Body.Close()
+		return nil, errors.New("connection reset by peer")
+	}
+	return res, err
+}
+
+func newTransfer(bank *mockbank.Server, store *memoryStore, lostPaths ...string) (eft.TransferFunc, func()) {
+	server := bank.Start()
+	cfg := config.EFTConfig{
+		MerchantID:      "M001",
+		BasicAuth:       "dXNlcjpwYXNz",
+		MaxInquiry:      3,
+		InquiryInterval: time.Millisecond,
+		Timeout:         config.EFTTimeoutConfig{OAuth: time.Second, Verify: time.Second, Transfer: 100 * time.Millisecond, Inquiry: time.Second},
+		Retry:           config.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, Multiplier: 2},
+	}
+	mockbank.Configure(&cfg, server.URL)
+
+	client := server.Client()
+	for _, path := range lostPaths {
+		client.Transport = lostResponse{next: client.Transport, path: path}
+	}
+	policy := eft.NewRetryPolicy(cfg.Retry)
+	transfer := eft.Transfer(
+		cfg,
+		eft.DirectAccessToken(cfg, eft.HTTPOauthFundTransferHttp(client, cfg.OAuthURL, cfg.Timeout.OAuth, policy)),
+		eft.NoopInvalidateAccessToken(),
+		eft.HTTPVerifyDataFundTransfer(client, cfg.VerifyURL, cfg.Timeout.Verify, policy),
+		eft.HTTPFundTransfer(client, cfg.TransferURL, cfg.Timeout.Transfer),
+		eft.HTTPInquiryStatusFundTransfer(client, cfg.InquiryURL, cfg.Timeout.Inquiry, policy),
+		store.create(),
+		store.transit(),
+	)
+	return transfer, server.Close
+}
+
+func transferRequest(merchantTransID string) eft.TransferRequest {
+	return eft.TransferRequest{VerifyDataFundTransferRequest: eft.VerifyDataFundTransferRequest{
+		MerchantTransID: merchantTransID,
+		ProxyType:       "ACCOUNT",
+		ProxyValue:      "1234567890",
+		FromAccountNo:   "0987654321",
+		ToBankCode:      "004",
+		Amount:          eft.MustAmount("1500.50"),
+	}}
+}
+
+func TestTransferAgainstMockBank(t *testing.T) {
+	inProcess := mockbank.Step{TxnStatus: eft.TxnStatusInProcess}
+	defer func(codes map[string]eft.ErrorKind) { eft.ResponseCodes = codes }(eft.ResponseCodes)
+	assert.Equal(t, nil, eft.SetResponseCodes(map[string]string{"1001": "INVALID_ACCOUNT", "2001": "INSUFFICIENT_FUNDS"}))
+
+	tests := []struct {
+		name     string
+		scenario mockbank.Scenario
+		want     string
+		kind     eft.ErrorKind
+		wantErr  bool
+		inquiry  int
+	}{
+		{name: "success", want: eft.StateSuccess, inquiry: 1},
+		{
+			name:     "oauth retried after 503",
+			scenario: mockbank.Scenario{OAuth: []mockbank.Step{{Status: http.StatusServiceUnavailable}, {}}},
+			want:     eft.StateSuccess, inquiry: 1,
+		},
+		{
+			name:     "in process then success",
+			scenario: mockbank.Scenario{Inquiry: []mockbank.Step{inProcess, inProcess, {}}},
+			want:     eft.StateSuccess, inquiry: 3,
+		},
+		{
+			name:     "confirm timeout resolved by inquiry",
+			scenario: mockbank.Scenario{Transfer: []mockbank.Step{{Delay: time.Second}}},
+			want:     eft.StateSuccess, inquiry: 1,
+		},
+		{
+			name:     "verify rejected",
+			scenario: mockbank.Scenario{Verify: []mockbank.Step{{ResponseCode: "2001", ResponseMsg: "Insufficient funds"}}},
+			want:     eft.StateFailed, kind: eft.KindInsufficientFunds,
+		},
+		{
+			// Nothing was confirmed, so even an unmapped code fails it safely.
+			name:     "verify rejected with unmapped code",
+			scenario: mockbank.Scenario{Verify: []mockbank.Step{{ResponseCode: "2999", ResponseMsg: "Rejected"}}},
+			want:     eft.StateFailed, kind: eft.KindUnknown,
+		},
+		{
+			name:     "confirm rejected",
+			scenario: mockbank.Scenario{Transfer: []mockbank.Step{{ResponseCode: "1001", ResponseMsg: "Invalid account"}}},
+			want:     eft.StateFailed, kind: eft.KindInvalidAccount,
+		},
+		{
+			// An unmapped code leaves the confirm open until inquiry settles it.
+			name:     "confirm unmapped code resolved by inquiry",
+			scenario: mockbank.Scenario{Transfer: []mockbank.Step{{ResponseCode: "1999", ResponseMsg: "Rejected"}}},
+			want:     eft.StateFailed, kind: eft.KindBusinessReject, inquiry: 1,
+		},
+		{
+			name:     "confirm 400 resolved by inquiry",
+			scenario: mockbank.Scenario{Transfer: []mockbank.Step{{Status: http.StatusBadRequest}}},
+			want:     eft.StateFailed, kind: eft.KindBusinessReject, inquiry: 1,
+		},
+		{
+			name:     "failed after inquiry",
+			scenario: mockbank.Scenario{Inquiry: []mockbank.Step{inProcess, {TxnStatus: eft.TxnStatusFail, FailMsg: "Account closed"}}},
+			want:     eft.StateFailed, kind: eft.KindBusinessReject, inquiry: 2,
+		},
+		{
+			name:     "still in process",
+			scenario: mockbank.Scenario{Inquiry: []mockbank.Step{inProcess}},
+			want:     eft.StateUnknown, wantErr: true, inquiry: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bank := mockbank.New(tt.scenario)
+			store := &memoryStore{states: map[string][]string{}}
+			transfer, closeBank := newTransfer(bank, store)
+			defer closeBank()
+
+			result, err := transfer(context.Background(), zap.NewNop(), transferRequest("T1"))
+			assert.Equal(t, tt.wantErr, err != nil, "err: %v", err)
+			assert.Equal(t, tt.want, result.Status)
+			if tt.kind != "" {
+				assert.Equal(t, tt.kind, result.Reason.Kind)
+			}
+			assert.Equal(t, tt.inquiry, bank.Calls(mockbank.PathInquiry))
+		})
+	}
+}
+
+func TestTransferConfirmTransportError(t *testing.T) {
+	bank := mockbank.New(mockbank.Scenario{})
+	store := &memoryStore{states: map[string][]string{}}
+	transfer, closeBank := newTransfer(bank, store, mockbank.PathTransfer)
+	defer closeBank()
+
+	result, err := transfer(context.Background(), zap.NewNop(), transferRequest("T1"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, eft.StateSuccess, result.Status)
+	assert.Equal(t, 1, bank.Calls(mockbank.PathTransfer))
+	assert.Equal(t, 1, bank.Calls(mockbank.PathInquiry))
+	assert.Equal(t, []string{eft.StateInitiated, eft.StateVerified, eft.StateSubmitted, eft.StateSuccess}, store.states["T1"])
+}
+
+func TestTransferDuplicateAtBank(t *testing.T) {
+	bank := mockbank.New(mockbank.Scenario{})
+	transfer, closeBank := newTransfer(bank, &memoryStore{states: map[string][]string{}})
+	defer closeBank()
+	result, err := transfer(context.Background(), zap.NewNop(), transferRequest("T1"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, eft.StateSuccess, result.Status)
+
+	// A second process without our record of T1 must not pay twice.
+	transfer, closeAgain := newTransfer(bank, &memoryStore{states: map[string][]string{}})
+	defer closeAgain()
+	result, err = transfer(context.Background(), zap.NewNop(), transferRequest("T1"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, eft.StateFailed, result.Status)
+	assert.Equal(t, mockbank.CodeDuplicate, result.Reason.Code)
+}
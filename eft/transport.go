@@ -0,0 +1,80 @@
+package eft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/httputil"
+	"go.uber.org/zap"
+)
+
+// NewHTTPClient builds the client for the bank gateway: server verification
+// on, the client certificate for mutual TLS, and the bank's SPKI pins when
+// set. A missing or expired client certificate is an error; one expiring
+// within cfg.CertExpiryWarning is logged.
+func NewHTTPClient(cfg config.HTTP, logger *zap.Logger) (*http.Client, error) {
+	if len(cfg.CertFile) == 0 {
+		return nil, errors.New("eft client certificate not configured")
+	}
+	tlsConfig, err := httputil.NewTLSConfig(httputil.TLSConfig{
+		CertFile:   cfg.CertFile,
+		KeyFile:    cfg.KeyFile,
+		CAFile:     cfg.CAFile,
+		PinnedSPKI: cfg.PinnedSPKI,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCertExpiry(cfg, logger); err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout: cfg.TimeOut,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConns:        cfg.MaxIdleConn,
+			MaxIdleConnsPerHost: cfg.MaxIdleConnPerHost,
+			MaxConnsPerHost:     cfg.MaxConnPerHost,
+		},
+	}, nil
+}
+
+// WatchCertExpiry checks the client certificate every cfg.CertCheckInterval
+// until ctx is done, for processes that outlive the check at startup. An
+// expired certificate is logged as an error and one close to expiry as a
+// warning.
+func WatchCertExpiry(ctx context.Context, logger *zap.Logger, cfg config.HTTP) {
+	if cfg.CertCheckInterval <= 0 {
+		return
+	}
+	for sleep(ctx, cfg.CertCheckInterval) == nil {
+		if err := checkCertExpiry(cfg, logger); err != nil {
+			logger.Error("Error eft client certificate", zap.Error(err))
+		}
+	}
+}
+
+func checkCertExpiry(cfg config.HTTP, logger *zap.Logger) error {
+	notAfter, err := httputil.CertNotAfter(cfg.CertFile)
+	if err != nil {
+		return fmt.Errorf("client certificate: %w", err)
+	}
+	remaining := time.Until(notAfter)
+	switch {
+	case remaining <= 0:
+		return fmt.Errorf("client certificate expired at %s", notAfter.Format(time.RFC3339))
+	case remaining < cfg.CertExpiryWarning:
+		logger.Warn("eft client certificate expires soon",
+			zap.Time("notAfter", notAfter),
+			zap.Int("daysLeft", int(remaining.Hours()/24)),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package eft
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/httputil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNewHTTPClientPinning(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	pin := "sha256/" + httputil.SPKIHash(server.Certificate())
+	certFile, keyFile := clientCert(t, time.Now().AddDate(1, 0, 0))
+
+	tests := []struct {
+		name   string
+		cfg    config.HTTP
+		errPin bool
+		ok     bool
+	}{
+		{name: "unknown CA", cfg: config.HTTP{}},
+		{name: "CA bundle", cfg: config.HTTP{CAFile: caFile}, ok: true},
+		{name: "pinned", cfg: config.HTTP{CAFile: caFile, PinnedSPKI: []string{"sha256/other", pin}}, ok: true},
+		{name: "pin mismatch", cfg: config.HTTP{CAFile: caFile, PinnedSPKI: []string{"sha256/other"}}, errPin: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.CertFile, tt.cfg.KeyFile = certFile, keyFile
+			client, err := NewHTTPClient(tt.cfg, zap.NewNop())
+			assert.Equal(t, nil, err)
+			res, err := client.Get(server.URL)
+			if err == nil {
+				res.Body.Close()
+			}
+			assert.Equal(t, tt.ok, err == nil, "err: %v", err)
+			assert.Equal(t, tt.errPin, errors.Is(err, httputil.ErrPinMismatch))
+		})
+	}
+}
+
+// clientCert returns a self-signed client certificate and key valid until notAfter.
+func clientCert(t *testing.T, notAfter time.Time) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, nil, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "merchant"},
+		NotBefore:    time.Now().AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Equal(t, nil, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Equal(t, nil, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestNewHTTPClientCertificate(t *testing.T) {
+	_, err := NewHTTPClient(config.HTTP{}, zap.NewNop())
+	assert.EqualError(t, err, "eft client certificate not configured")
+
+	certFile, keyFile := clientCert(t, time.Now().AddDate(0, 0, -1))
+	_, err = NewHTTPClient(config.HTTP{CertFile: certFile, KeyFile: keyFile}, zap.NewNop())
+	assert.Contains(t, err.Error(), "client certificate expired")
+}
+
+func TestWatchCertExpiry(t *testing.T) {
+	certFile, keyFile := clientCert(t, time.Now().Add(time.Hour))
+	core, logs := observer.New(zap.WarnLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// A certificate that was fine at startup is reported again while running.
+	WatchCertExpiry(ctx, zap.New(core), config.HTTP{CertFile: certFile, KeyFile: keyFile, CertExpiryWarning: 24 * time.Hour, CertCheckInterval: 10 * time.Millisecond})
+	assert.Equal(t, true, logs.FilterMessage("eft client certificate expires soon").Len() > 0)
+}
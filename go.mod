@@ -4,8 +4,10 @@ go 1.18
 
 require (
 	github.com/Shopify/sarama v1.36.0
+	github.com/alicebob/miniredis/v2 v2.36.1
 	github.com/aws/aws-lambda-go v1.45.0
 	github.com/aws/aws-sdk-go v1.49.17
+	github.com/go-jose/go-jose/v3 v3.0.5
 	github.com/go-redis/redis/v9 v9.0.0-beta.2
 	github.com/google/uuid v1.6.0
 	github.com/jackc/pgx/v4 v4.17.0
@@ -14,11 +16,12 @@ require (
 	github.com/pkg/sftp v1.13.6
 	github.com/shopspring/decimal v1.2.0
 	github.com/spf13/viper v1.12.0
+	github.com/stretchr/testify v1.8.4
 	github.com/xdg-go/scram v1.1.1
 	go.uber.org/zap v1.21.0
-	golang.org/x/crypto v0.18.0
+	golang.org/x/crypto v0.19.0
 	golang.org/x/exp v0.0.0-20240119083558-1b970713d09a
-
+	golang.org/x/sync v0.1.0
 )
 
 require (
@@ -63,18 +66,17 @@ require (
 	github.com/spf13/cast v1.5.0 // indirect
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/stretchr/testify v1.8.4 // indirect
 	github.com/subosito/gotenv v1.3.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasthttp v1.38.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
 	github.com/xdg-go/stringprep v1.0.3 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/sync v0.1.0 // indirect
-	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	gopkg.in/ini.v1 v1.66.4 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
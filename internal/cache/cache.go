@@ -10,9 +10,11 @@ import (
 )
 
 const (
-	FundTransferTokenKey = "OAUTHTOKEN:FUNDTRANSFER"
-	OAuthCountKey        = "OAUTHTOKEN:COUNT:%s"
-	PaymentKey           = "PAYMENT:%s"
+	FundTransferTokenKey     = "OAUTHTOKEN:FUNDTRANSFER"
+	FundTransferTokenLockKey = "OAUTHTOKEN:FUNDTRANSFER:LOCK"
+	OAuthCountKey            = "OAUTHTOKEN:COUNT:%s"
+	PaymentKey               = "PAYMENT:%s"
+	EFTRateKey               = "EFT:RATE:%d"
 )
 
 var mode string
@@ -118,6 +120,32 @@ func SetRedisNX(cmd redis.Cmdable) SetRedisNXFunc {
 	}
 }
 
+// TrySetRedisNXFunc reports whether the key was set, unlike SetRedisNXFunc.
+type TrySetRedisNXFunc func(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+
+func TrySetRedisNX(cmd redis.Cmdable) TrySetRedisNXFunc {
+	return func(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+		return cmd.SetNX(ctx, key, value, expiration).Result()
+	}
+}
+
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// CompareAndDeleteRedisFunc deletes key only while it still holds value, e.g.
+// to release a lock without removing one that expired and was taken by someone else.
+type CompareAndDeleteRedisFunc func(ctx context.Context, key string, value string) error
+
+func CompareAndDeleteRedis(cmd redis.Cmdable) CompareAndDeleteRedisFunc {
+	return func(ctx context.Context, key string, value string) error {
+		return compareAndDeleteScript.Run(ctx, cmd, []string{key}, value).Err()
+	}
+}
+
 type GetRedisFunc func(ctx context.Context, key string) (string, error)
 
 func GetRedis(cmd redis.Cmdable) GetRedisFunc {
@@ -72,14 +72,13 @@ func InitHttpClientWithCert(timeout time.Duration, maxIdleConns, maxIdleConnsPer
 		return nil, err
 	}
 	if !rootCAs.AppendCertsFromPEM(CertFile) {
-		fmt.Println("Cannot AppendCerts\n", string(CertFile))
+		return nil, errors.New("no certificate found in CertFile")
 	}
 	client := &http.Client{
 		Timeout: timeout,
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{
-				RootCAs:            rootCAs,
-				InsecureSkipVerify: true,
+				RootCAs: rootCAs,
 			},
 			MaxIdleConns:        maxIdleConns,
 			MaxIdleConnsPerHost: maxIdleConnsPerHost,
@@ -126,38 +125,13 @@ func NewHttpPostCall(client *http.Client, url string) HTTPPostRequestFunc {
 	}
 }
 
+// NewHttpPostPaymentCall posts through client, which carries the client
+// certificate; build it once with NewTLSConfig or InitHttpClientWithCertAndKey.
 func NewHttpPostPaymentCall(client *http.Client) HTTPPostPaymentRequestFunc {
 	return func(url string, reqBody []byte, auth string, contentType string) ([]byte, error) {
 
 		//message, _ := json.Marshal(&reqBody)
 
-		// make SSL certificate and key
-		certFile := "star_allgold_arrgx_com.crt"
-		keyFile := "_.allgold.arrgx.com.key"
-
-		// read certificate and key from file
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-		if err != nil {
-			fmt.Println("Can't download certificate และ key:", err)
-			return nil, err
-		}
-
-		// Create HTTP client
-		rootCAs, err := x509.SystemCertPool()
-		if err != nil {
-			fmt.Println("Cert error:", err)
-			return nil, err
-		}
-
-		rootCAs.AppendCertsFromPEM([]byte(certFile))
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{
-				Certificates: []tls.Certificate{cert},
-				RootCAs:      rootCAs,
-			},
-		}
-		client := &http.Client{Transport: transport}
-
 		req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBody))
 		if err != nil {
 			return nil, errors.Wrap(err, "Unable to New http Request")
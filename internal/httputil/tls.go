@@ -0,0 +1,87 @@
+package httputil
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrPinMismatch = errors.New("server certificate does not match any pinned SPKI")
+
+// TLSConfig builds a verifying client TLS config. CertFile and KeyFile are
+// the PEM client certificate and key for mutual TLS, CAFile extra PEM roots
+// on top of the system pool. PinnedSPKI holds base64 SHA-256 digests of
+// SubjectPublicKeyInfo, optionally prefixed "sha256/"; when set, one
+// certificate of the verified chain must match.
+type TLSConfig struct {
+	CertFile   []byte
+	KeyFile    []byte
+	CAFile     []byte
+	PinnedSPKI []string
+}
+
+func NewTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to load system cert pool")
+	}
+	if len(cfg.CAFile) > 0 && !rootCAs.AppendCertsFromPEM(cfg.CAFile) {
+		return nil, errors.New("no certificate found in CA bundle")
+	}
+	tlsConfig := &tls.Config{
+		RootCAs:    rootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(cfg.CertFile) > 0 || len(cfg.KeyFile) > 0 {
+		cert, err := tls.X509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(cfg.PinnedSPKI) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range cfg.PinnedSPKI {
+			pins[strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")] = true
+		}
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, chain := range state.VerifiedChains {
+				for _, cert := range chain {
+					if pins[SPKIHash(cert)] {
+						return nil
+					}
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+	return tlsConfig, nil
+}
+
+// SPKIHash is the base64 SHA-256 digest of cert's SubjectPublicKeyInfo, the
+// value PinnedSPKI expects.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// CertNotAfter returns the expiry of the first certificate in a PEM bundle.
+func CertNotAfter(certPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return time.Time{}, errors.New("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
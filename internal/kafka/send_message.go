@@ -13,6 +13,10 @@ type SendMessageAsyncFunc func(event interface{})
 type SendMessageSyncFunc func(log *zap.Logger, event interface{}) error
 type SendMessageSyncWithTopicFunc func(log *zap.Logger, event interface{}, topic string) error
 
+// SendMessageSyncWithKeyFunc sends with a message key, so events sharing a
+// key land on the same partition in order.
+type SendMessageSyncWithKeyFunc func(log *zap.Logger, key string, event interface{}, topic string) error
+
 func NewSendMessageSyncWithTopic(producer sarama.SyncProducer) SendMessageSyncWithTopicFunc {
 
 	return func(log *zap.Logger, event interface{}, topic string) error {
@@ -34,6 +38,25 @@ func NewSendMessageSyncWithTopic(producer sarama.SyncProducer) SendMessageSyncWi
 		return nil
 	}
 }
+
+func NewSendMessageSyncWithKey(producer sarama.SyncProducer) SendMessageSyncWithKeyFunc {
+	return func(log *zap.Logger, key string, event interface{}, topic string) error {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		message := &sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(key), Value: sarama.ByteEncoder(value)}
+		partition, offset, err := producer.SendMessage(message)
+		if err != nil {
+			return errors.New(fmt.Sprintf("topic: %s key: %s partition: %v, offset: %v, error: %v", topic, key, partition, offset, err))
+		}
+
+		log.Info(fmt.Sprintf("SendMessage Success with topic: %s, Key: %s, Partition: %v, Offset: %v", topic, key, partition, offset))
+		return nil
+	}
+}
+
 func NewAsyncSendMessage(producer sarama.AsyncProducer, topic string) SendMessageAsyncFunc {
 	return func(event interface{}) {
 		value, err := json.Marshal(event)
@@ -1,6 +1,7 @@
 package secret
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -22,6 +23,8 @@ type CommonConfig struct {
 	RedisPassword  string `json:"REDIS_PASSWORD"`
 	KeyFile        string `json:"KEY_FILE"`
 	CertFile       string `json:"CERT_FILE"`
+	CABundle       string `json:"CA_BUNDLE"`
+	BankPublicKey  string `json:"BANK_PUBLIC_KEY"`
 }
 
 func ConfigCommonSecret(cfg *config.Config) error {
@@ -46,27 +49,36 @@ func ConfigCommonSecret(cfg *config.Config) error {
 	cfg.Kafka.Internal.Password = commonConfig.KafkaPassword
 	switch strings.ToUpper(cfg.Env) {
 	case "DEV":
-		cfg.Secret.Private = commonConfig.PrivateKeyDEV
+		cfg.Secret.Private = string(pemBytes(commonConfig.PrivateKeyDEV))
 	case "UAT":
-		cfg.Secret.Private = commonConfig.PrivateKeyUAT
+		cfg.Secret.Private = string(pemBytes(commonConfig.PrivateKeyUAT))
 	case "PROD":
-		cfg.Secret.Private = commonConfig.PrivateKeyProd
+		cfg.Secret.Private = string(pemBytes(commonConfig.PrivateKeyProd))
 	}
+	cfg.EFT.HTTP.CertFile = pemBytes(commonConfig.CertFile)
+	cfg.EFT.HTTP.KeyFile = pemBytes(commonConfig.KeyFile)
+	cfg.EFT.HTTP.CAFile = pemBytes(commonConfig.CABundle)
+	cfg.EFT.Signing.BankPublicKey = pemBytes(commonConfig.BankPublicKey)
 	if commonConfig.RedisPassword != "" {
 		//TODO WITH Redis Password
 		cfg.RedisConfig.Password = commonConfig.RedisPassword
 	}
 
-	//
-	//decodedPrivateKey, err := base64.StdEncoding.DecodeString(cfg.Secret.Private)
-	//if err != nil {
-	//	return err
-	//}
-	//cfg.Secret.Private = string(decodedPrivateKey)
-
 	return nil
 }
 
+// pemBytes accepts PEM as is or base64 encoded, as secrets often store it.
+func pemBytes(value string) []byte {
+	if value == "" || strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return []byte(value)
+	}
+	return decoded
+}
+
 type RDSConfig struct {
 	Username             string          `json:"username"`
 	Password             string          `json:"password"`
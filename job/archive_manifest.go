@@ -0,0 +1,68 @@
+package job
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+)
+
+const manifestSuffix = ".manifest.json"
+
+type ArchiveManifest struct {
+	Partition string    `json:"partition"`
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Source is the reconciled digest of the partition at export time.
+	Source       PartitionDigest `json:"source"`
+	ArchivedRows int             `json:"archivedRows"`
+	RejectedRows int             `json:"rejectedRows"`
+}
+
+func NewArchiveManifest(cfg *config.Config, partitions string, export ExportResult) ArchiveManifest {
+	content := export.Archive.Bytes()
+	sum := sha256.Sum256(content)
+	return ArchiveManifest{
+		Partition:    partitions,
+		Bucket:       cfg.S3Config.BucketName,
+		Key:          ArchiveKey(cfg, partitions),
+		Size:         int64(len(content)),
+		SHA256:       hex.EncodeToString(sum[:]),
+		CreatedAt:    time.Now(),
+		Source:       export.Digest,
+		ArchivedRows: export.Quality.Rows - export.Quality.RejectedRows,
+		RejectedRows: export.Quality.RejectedRows,
+	}
+}
+
+func ArchiveKey(cfg *config.Config, partitions string) string {
+	return fmt.Sprintf(cfg.S3Config.Key, partitions)
+}
+
+func ManifestKey(archiveKey string) string {
+	return archiveKey + manifestSuffix
+}
+
+func RejectedRowsKey(archiveKey string) string {
+	return strings.TrimSuffix(archiveKey, path.Ext(archiveKey)) + "_rejected.csv"
+}
+
+func IsManifestKey(key string) bool {
+	return strings.HasSuffix(key, manifestSuffix)
+}
+
+// ArchivePrefix is the directory part of S3Config.Key, e.g. "his_pricing/".
+func ArchivePrefix(cfg *config.Config) string {
+	dir := path.Dir(cfg.S3Config.Key)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir + "/"
+}
@@ -0,0 +1,312 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/kafka"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/logz"
+	"go.uber.org/zap"
+)
+
+const (
+	AuditIssueMissing          = "MISSING"
+	AuditIssueSizeMismatch     = "SIZE_MISMATCH"
+	AuditIssueChecksumMismatch = "CHECKSUM_MISMATCH"
+	AuditIssueUnreadable       = "UNREADABLE"
+	AuditIssueBadManifest      = "BAD_MANIFEST"
+	AuditIssueNoManifest       = "NO_MANIFEST"
+	AuditIssueBadPartition     = "BAD_PARTITION"
+)
+
+var ErrArchiveAuditFailed = errors.New("archive audit found issues")
+
+type ArchiveObject struct {
+	Key  string
+	Size int64
+}
+
+type ArchiveAuditIssue struct {
+	Partition string `json:"partition"`
+	Key       string `json:"key"`
+	Kind      string `json:"kind"`
+	Detail    string `json:"detail"`
+}
+
+type ArchiveAuditReport struct {
+	Bucket     string              `json:"bucket"`
+	Prefix     string              `json:"prefix"`
+	StartedAt  time.Time           `json:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt"`
+	Manifests  int                 `json:"manifests"`
+	Healthy    int                 `json:"healthy"`
+	Issues     []ArchiveAuditIssue `json:"issues"`
+	Gaps       []string            `json:"gaps"`
+	OK         bool                `json:"ok"`
+}
+
+func AuditArchive(
+	cfg *config.Config,
+	ListArchiveObjectsFunc ListArchiveObjectsFunc,
+	GetArchiveManifestFunc GetArchiveManifestFunc,
+	VerifyArchiveObjectFunc VerifyArchiveObjectFunc,
+	PublishAuditReportFuncs ...PublishAuditReportFunc,
+) (*ArchiveAuditReport, error) {
+
+	logger := logz.NewLogger()
+	ctx := context.Background()
+
+	report := &ArchiveAuditReport{
+		Bucket:    cfg.S3Config.BucketName,
+		Prefix:    ArchivePrefix(cfg),
+		StartedAt: time.Now(),
+		Issues:    []ArchiveAuditIssue{},
+		Gaps:      []string{},
+	}
+
+	planner, err := NewPartitionPlanner(cfg.Partition.Scheme, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	// The newest planned partition is the last one that should be archived.
+	planned, err := PlanPartitions(cfg.Partition, time.Local, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := ListArchiveObjectsFunc(ctx, logger, report.Prefix)
+	if err != nil {
+		logger.Error("Error ListArchiveObjectsFunc", zap.Error(err))
+		return nil, err
+	}
+
+	manifested := map[string]bool{}
+	var partitions []string
+	for _, object := range objects {
+		if !IsManifestKey(object.Key) {
+			continue
+		}
+		report.Manifests++
+		manifest, err := GetArchiveManifestFunc(ctx, logger, object.Key)
+		if err != nil {
+			logger.Error("Error GetArchiveManifestFunc", zap.String("key", object.Key), zap.Error(err))
+			report.Issues = append(report.Issues, ArchiveAuditIssue{
+				Key:    object.Key,
+				Kind:   AuditIssueBadManifest,
+				Detail: err.Error(),
+			})
+			continue
+		}
+		manifested[manifest.Key] = true
+		partitions = append(partitions, manifest.Partition)
+
+		issue, err := VerifyArchiveObjectFunc(ctx, logger, *manifest)
+		if err != nil {
+			logger.Error("Error VerifyArchiveObjectFunc", zap.String("key", manifest.Key), zap.Error(err))
+			return nil, err
+		}
+		if issue != nil {
+			report.Issues = append(report.Issues, *issue)
+			continue
+		}
+		if _, err := planner.Parse(manifest.Partition); err != nil {
+			report.Issues = append(report.Issues, ArchiveAuditIssue{
+				Partition: manifest.Partition,
+				Key:       manifest.Key,
+				Kind:      AuditIssueBadPartition,
+				Detail:    err.Error(),
+			})
+			continue
+		}
+		report.Healthy++
+	}
+
+	for _, object := range objects {
+		if IsManifestKey(object.Key) || manifested[object.Key] || !strings.HasSuffix(object.Key, ".zip") {
+			continue
+		}
+		report.Issues = append(report.Issues, ArchiveAuditIssue{
+			Key:    object.Key,
+			Kind:   AuditIssueNoManifest,
+			Detail: "archive has no manifest",
+		})
+	}
+
+	report.Gaps = planner.Gaps(partitions, planned[len(planned)-1])
+	report.FinishedAt = time.Now()
+	report.OK = len(report.Issues) == 0 && len(report.Gaps) == 0
+
+	logger.Info("archive audit finished",
+		zap.Int("manifests", report.Manifests),
+		zap.Int("healthy", report.Healthy),
+		zap.Int("issues", len(report.Issues)),
+		zap.Strings("gaps", report.Gaps),
+	)
+
+	for _, publish := range PublishAuditReportFuncs {
+		if err := publish(ctx, logger, *report); err != nil {
+			logger.Error("Error PublishAuditReportFunc", zap.Error(err))
+			return report, err
+		}
+	}
+
+	if !report.OK {
+		return report, ErrArchiveAuditFailed
+	}
+	return report, nil
+}
+
+type ListArchiveObjectsFunc func(ctx context.Context, logger *zap.Logger, prefix string) ([]ArchiveObject, error)
+
+func ListArchiveObjects(svc *s3.S3, cfg *config.Config) ListArchiveObjectsFunc {
+	return func(ctx context.Context, logger *zap.Logger, prefix string) ([]ArchiveObject, error) {
+		var objects []ArchiveObject
+		err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket: &cfg.S3Config.BucketName,
+			Prefix: &prefix,
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, object := range page.Contents {
+				objects = append(objects, ArchiveObject{
+					Key:  aws.StringValue(object.Key),
+					Size: aws.Int64Value(object.Size),
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("listed archive objects", zap.String("prefix", prefix), zap.Int("count", len(objects)))
+		return objects, nil
+	}
+}
+
+type GetArchiveManifestFunc func(ctx context.Context, logger *zap.Logger, key string) (*ArchiveManifest, error)
+
+func GetArchiveManifest(svc *s3.S3, cfg *config.Config) GetArchiveManifestFunc {
+	return func(ctx context.Context, logger *zap.Logger, key string) (*ArchiveManifest, error) {
+		out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: &cfg.S3Config.BucketName,
+			Key:    &key,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer out.Body.Close()
+
+		var manifest ArchiveManifest
+		if err := json.NewDecoder(out.Body).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("decode manifest %s: %w", key, err)
+		}
+		if manifest.Key == "" || manifest.SHA256 == "" {
+			return nil, fmt.Errorf("manifest %s is missing key or checksum", key)
+		}
+		return &manifest, nil
+	}
+}
+
+// VerifyArchiveObjectFunc returns an issue when the archive does not match its
+// manifest. An error is only returned when the check itself could not run.
+type VerifyArchiveObjectFunc func(ctx context.Context, logger *zap.Logger, manifest ArchiveManifest) (*ArchiveAuditIssue, error)
+
+func VerifyArchiveObject(svc *s3.S3) VerifyArchiveObjectFunc {
+	return func(ctx context.Context, logger *zap.Logger, manifest ArchiveManifest) (*ArchiveAuditIssue, error) {
+		issue := func(kind, detail string) *ArchiveAuditIssue {
+			return &ArchiveAuditIssue{Partition: manifest.Partition, Key: manifest.Key, Kind: kind, Detail: detail}
+		}
+
+		head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: &manifest.Bucket,
+			Key:    &manifest.Key,
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return issue(AuditIssueMissing, "archive object not found"), nil
+			}
+			return nil, err
+		}
+		if size := aws.Int64Value(head.ContentLength); size != manifest.Size {
+			return issue(AuditIssueSizeMismatch, fmt.Sprintf("expected %d bytes, found %d", manifest.Size, size)), nil
+		}
+
+		out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: &manifest.Bucket,
+			Key:    &manifest.Key,
+		})
+		if err != nil {
+			return issue(AuditIssueUnreadable, err.Error()), nil
+		}
+		defer out.Body.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, out.Body); err != nil {
+			return issue(AuditIssueUnreadable, err.Error()), nil
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != manifest.SHA256 {
+			return issue(AuditIssueChecksumMismatch, fmt.Sprintf("expected %s, found %s", manifest.SHA256, sum)), nil
+		}
+		return nil, nil
+	}
+}
+
+func isNotFound(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == "NotFound" || awsErr.Code() == s3.ErrCodeNoSuchKey
+	}
+	return false
+}
+
+type PublishAuditReportFunc func(ctx context.Context, logger *zap.Logger, report ArchiveAuditReport) error
+
+func PutAuditReportToS3(svc *s3.S3, cfg *config.Config) PublishAuditReportFunc {
+	return func(ctx context.Context, logger *zap.Logger, report ArchiveAuditReport) error {
+		body, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf(cfg.Audit.ReportKey, report.StartedAt.Format("_20060102T150405"))
+		_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      &cfg.S3Config.BucketName,
+			Key:         &key,
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info("archive audit report written", zap.String("key", key))
+		return nil
+	}
+}
+
+func PublishAuditReportToKafka(send kafka.SendMessageSyncWithTopicFunc, topic string) PublishAuditReportFunc {
+	return func(ctx context.Context, logger *zap.Logger, report ArchiveAuditReport) error {
+		return send(logger, report, topic)
+	}
+}
+
+func InsertAuditReport(db *pgxpool.Pool) PublishAuditReportFunc {
+	return func(ctx context.Context, logger *zap.Logger, report ArchiveAuditReport) error {
+		body, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		sql := `insert into archive_audit_report (bucket, prefix, started_at, finished_at, ok, report) values ($1, $2, $3, $4, $5, $6)`
+		_, err = db.Exec(ctx, sql, report.Bucket, report.Prefix, report.StartedAt, report.FinishedAt, report.OK, body)
+		return err
+	}
+}
@@ -0,0 +1,124 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+func TestAuditArchive(t *testing.T) {
+	cfg := &config.Config{
+		S3Config:  config.S3Config{BucketName: "bucket", Key: "his_pricing/his_pricing%s.zip"},
+		Partition: config.PartitionConfig{Scheme: PartitionMonthly, From: "2024-01", To: "2024-04"},
+	}
+	archive := func(partition string) string { return ArchiveKey(cfg, partition) }
+	objects := func(keys ...string) ListArchiveObjectsFunc {
+		return func(ctx context.Context, logger *zap.Logger, prefix string) ([]ArchiveObject, error) {
+			assert.Equal(t, "his_pricing/", prefix)
+			var list []ArchiveObject
+			for _, key := range keys {
+				list = append(list, ArchiveObject{Key: key})
+			}
+			return list, nil
+		}
+	}
+	getManifest := func(ctx context.Context, logger *zap.Logger, key string) (*ArchiveManifest, error) {
+		if strings.Contains(key, "broken") {
+			return nil, errors.New("manifest is missing key or checksum")
+		}
+		key = strings.TrimSuffix(key, manifestSuffix)
+		partition := strings.TrimSuffix(strings.TrimPrefix(key, "his_pricing/his_pricing"), ".zip")
+		return &ArchiveManifest{Partition: partition, Key: key}, nil
+	}
+	verifyObject := func(ctx context.Context, logger *zap.Logger, manifest ArchiveManifest) (*ArchiveAuditIssue, error) {
+		kind := map[string]string{
+			archive("_y2024m02"): AuditIssueMissing,
+			archive("_y2024m03"): AuditIssueSizeMismatch,
+			archive("_y2024m04"): AuditIssueChecksumMismatch,
+		}[manifest.Key]
+		if kind == "" {
+			return nil, nil
+		}
+		return &ArchiveAuditIssue{Partition: manifest.Partition, Key: manifest.Key, Kind: kind}, nil
+	}
+	withManifests := func(partitions ...string) []string {
+		var keys []string
+		for _, partition := range partitions {
+			keys = append(keys, archive(partition), ManifestKey(archive(partition)))
+		}
+		return keys
+	}
+
+	tests := []struct {
+		name    string
+		keys    []string
+		issues  map[string]string
+		gaps    []string
+		healthy int
+	}{
+		{
+			name: "issues",
+			keys: append(withManifests("_y2024m01", "_y2024m02", "_y2024m03", "_y2024m04", "-2024-05"),
+				"his_pricing/broken"+manifestSuffix,
+				archive("_y2023m12"),
+			),
+			issues: map[string]string{
+				archive("_y2024m02"):                  AuditIssueMissing,
+				archive("_y2024m03"):                  AuditIssueSizeMismatch,
+				archive("_y2024m04"):                  AuditIssueChecksumMismatch,
+				archive("-2024-05"):                   AuditIssueBadPartition,
+				"his_pricing/broken" + manifestSuffix: AuditIssueBadManifest,
+				archive("_y2023m12"):                  AuditIssueNoManifest,
+			},
+			gaps:    []string{},
+			healthy: 1,
+		},
+		{
+			name:    "recent partitions missing",
+			keys:    withManifests("_y2024m01"),
+			issues:  map[string]string{},
+			gaps:    []string{"_y2024m02", "_y2024m03", "_y2024m04"},
+			healthy: 1,
+		},
+		{
+			name:    "nothing archived",
+			issues:  map[string]string{},
+			gaps:    []string{"_y2024m04"},
+			healthy: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var published []ArchiveAuditReport
+			publish := func(ctx context.Context, logger *zap.Logger, report ArchiveAuditReport) error {
+				published = append(published, report)
+				return nil
+			}
+			report, err := AuditArchive(cfg, objects(tt.keys...), getManifest, verifyObject, publish)
+			assert.Equal(t, true, errors.Is(err, ErrArchiveAuditFailed), "err: %v", err)
+			assert.Equal(t, false, report.OK)
+
+			issues := map[string]string{}
+			for _, issue := range report.Issues {
+				issues[issue.Key] = issue.Kind
+			}
+			assert.Equal(t, tt.issues, issues)
+			assert.Equal(t, tt.gaps, report.Gaps)
+			assert.Equal(t, tt.healthy, report.Healthy)
+			assert.Equal(t, 1, len(published))
+		})
+	}
+
+	healthy := func(ctx context.Context, logger *zap.Logger, manifest ArchiveManifest) (*ArchiveAuditIssue, error) {
+		return nil, nil
+	}
+	report, err := AuditArchive(cfg, objects(withManifests("_y2024m01", "_y2024m02", "_y2024m03", "_y2024m04")...), getManifest, healthy)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, report.OK)
+	assert.Equal(t, 4, report.Healthy)
+}
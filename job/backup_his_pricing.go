@@ -5,84 +5,69 @@ import (
 	"bytes"
 	"context"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
 	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/logz"
 	"go.uber.org/zap"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 )
 
 func BackUpHisPricing(
+	partitions []Partition,
 	GetDataHisPricingFunc GetDataHisPricingFunc,
 	PushToS3Func PushToS3Func,
+	PushRejectedRowsFunc PushRejectedRowsFunc,
+	ReconcilePartitionFunc ReconcilePartitionFunc,
 	DetachPartitionHistoryFunc DetachPartitionHistoryFunc,
 ) error {
 
 	logger := logz.NewLogger()
 	ctx := context.Background()
-	_ = ctx
-	startPartition := os.Getenv("startPartition")
-	//startPartition := "2024-04-01"
-	if startPartition == "" {
-		currentDate := time.Now()
-		tempCurrentDate := currentDate.AddDate(0, -1, 0)
-		partitions := tempCurrentDate.Format("_y2006m01")
-		zipFile, err := GetDataHisPricingFunc(ctx, logger, partitions)
+	if len(partitions) == 0 {
+		return errors.New("no partitions planned for backup")
+	}
+
+	for _, partition := range partitions {
+		export, err := GetDataHisPricingFunc(ctx, logger, partition)
 		if err != nil {
 			logger.Error("Error GetDataHisPricingFunc", zap.Any("", err.Error()))
 			return err
 		}
-		err = PushToS3Func(ctx, logger, zipFile, partitions)
+		logger.Info("data quality", zap.Any("report", export.Quality))
+		if export.Quality.RejectedRows > 0 {
+			err = PushRejectedRowsFunc(ctx, logger, export.Rejected, partition.Name)
+			if err != nil {
+				logger.Error("Error PushRejectedRowsFunc", zap.Any("", err.Error()))
+				return err
+			}
+		}
+		if export.Quality.Failed {
+			return fmt.Errorf("%w: partition %s rejected %d of %d rows", ErrQualityThreshold, partition.Name, export.Quality.RejectedRows, export.Quality.Rows)
+		}
+		err = PushToS3Func(ctx, logger, export, partition.Name)
 		if err != nil {
 			logger.Error("Error PushToS3Func", zap.Any("", err.Error()))
 			return err
 		}
-		err = DetachPartitionHistoryFunc(ctx, logger, "")
-
+		// Reconciled against the uploaded archive, so only a partition that
+		// is safely in storage is detached.
+		err = ReconcilePartitionFunc(ctx, logger, partition, export)
 		if err != nil {
-			logger.Error("Error DetachPartitionHistoryFunc", zap.Any("", err.Error()))
+			logger.Error("Error ReconcilePartitionFunc", zap.Any("", err.Error()))
 			return err
 		}
-	} else {
-		numStr := os.Getenv("numOfMonth")
-		//numStr := "1"
-		num, err := strconv.Atoi(numStr)
-		if err != nil {
-			logger.Error("Error parsing date:", zap.Error(err))
-		}
-		layout := "2006-01-02"
-		currentDate, err := time.Parse(layout, startPartition)
-		if err != nil {
-			logger.Error("Error parsing date:", zap.Error(err))
-		}
-		for i := 0; i < num; i++ {
-			tempCurrentDate := currentDate.AddDate(0, i, 0)
-			partitions := tempCurrentDate.Format("_y2006m01")
-			zipFile, err := GetDataHisPricingFunc(ctx, logger, partitions)
-			if err != nil {
-				logger.Error("Error GetDataHisPricingFunc", zap.Any("", err.Error()))
-				return err
-			}
-			err = PushToS3Func(ctx, logger, zipFile, partitions)
-			if err != nil {
-				logger.Error("Error PushToS3Func", zap.Any("", err.Error()))
-				return err
-			}
-
-		}
-		err = DetachPartitionHistoryFunc(ctx, logger, "")
-
+		err = DetachPartitionHistoryFunc(ctx, logger, partition.Name)
 		if err != nil {
 			logger.Error("Error DetachPartitionHistoryFunc", zap.Any("", err.Error()))
 			return err
 		}
-
 	}
 
 	return nil
@@ -90,24 +75,40 @@ func BackUpHisPricing(
 
 type DetachPartitionHistoryFunc func(ctx context.Context, logger *zap.Logger, partition string) error
 
+// DetachPartitionHistory detaches one archived partition from his_pricing and
+// drops it, in a single transaction.
 func DetachPartitionHistory(db *pgxpool.Pool) DetachPartitionHistoryFunc {
 	return func(ctx context.Context, logger *zap.Logger, partition string) error {
-		sql := `truncate table his_pricing`
-		//sql := `ALTER TABLE his_pricing DETACH PARTITION his_pricing%s;`
-		//sql = fmt.Sprintf(sql, partition)
-		_, err := db.Exec(ctx, sql)
+		tx, err := db.Begin(ctx)
 		if err != nil {
 			return err
 		}
+		defer func(tx pgx.Tx) {
+			_ = tx.Rollback(ctx)
+		}(tx)
+
+		sql := `ALTER TABLE his_pricing DETACH PARTITION his_pricing%s`
+		if _, err := tx.Exec(ctx, fmt.Sprintf(sql, partition)); err != nil {
+			return err
+		}
+		sql = `DROP TABLE his_pricing%s`
+		if _, err := tx.Exec(ctx, fmt.Sprintf(sql, partition)); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+		logger.Info("partition detached", zap.String("partition", partition))
 		return nil
 	}
 }
 
-type PushToS3Func func(ctx context.Context, logger *zap.Logger, zipFile bytes.Buffer, partitions string) error
+type PushToS3Func func(ctx context.Context, logger *zap.Logger, export ExportResult, partitions string) error
 
 func PushToS3(svc *s3.S3, cfg *config.Config) PushToS3Func {
-	return func(ctx context.Context, logger *zap.Logger, zipFile bytes.Buffer, partitions string) error {
-		key := fmt.Sprintf(cfg.S3Config.Key, partitions)
+	return func(ctx context.Context, logger *zap.Logger, export ExportResult, partitions string) error {
+		zipFile := export.Archive
+		key := ArchiveKey(cfg, partitions)
 		_, err := svc.PutObject(&s3.PutObjectInput{
 			Bucket: &cfg.S3Config.BucketName,
 			Key:    &key,
@@ -116,6 +117,21 @@ func PushToS3(svc *s3.S3, cfg *config.Config) PushToS3Func {
 		if err != nil {
 			return err
 		}
+
+		manifest, err := json.Marshal(NewArchiveManifest(cfg, partitions, export))
+		if err != nil {
+			return err
+		}
+		manifestKey := ManifestKey(key)
+		_, err = svc.PutObject(&s3.PutObjectInput{
+			Bucket:      &cfg.S3Config.BucketName,
+			Key:         &manifestKey,
+			Body:        bytes.NewReader(manifest),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return err
+		}
 		defer func() {
 			zipFile.Reset()
 		}()
@@ -124,62 +140,133 @@ func PushToS3(svc *s3.S3, cfg *config.Config) PushToS3Func {
 	}
 }
 
-type GetDataHisPricingFunc func(ctx context.Context, logger *zap.Logger, partitions string) (bytes.Buffer, error)
+type PushRejectedRowsFunc func(ctx context.Context, logger *zap.Logger, rejected bytes.Buffer, partitions string) error
 
-func GetDataHisPricing(db *pgxpool.Pool) GetDataHisPricingFunc {
-	return func(ctx context.Context, logger *zap.Logger, partitions string) (bytes.Buffer, error) {
-		tx, err := db.Begin(ctx)
+func PushRejectedRowsToS3(svc *s3.S3, cfg *config.Config) PushRejectedRowsFunc {
+	return func(ctx context.Context, logger *zap.Logger, rejected bytes.Buffer, partitions string) error {
+		key := RejectedRowsKey(ArchiveKey(cfg, partitions))
+		_, err := svc.PutObject(&s3.PutObjectInput{
+			Bucket:      &cfg.S3Config.BucketName,
+			Key:         &key,
+			Body:        bytes.NewReader(rejected.Bytes()),
+			ContentType: aws.String("text/csv"),
+		})
 		if err != nil {
-			return bytes.Buffer{}, err
+			return err
+		}
+		logger.Warn("rejected rows written", zap.String("key", key))
+		return nil
+	}
+}
+
+type ExportResult struct {
+	Archive  bytes.Buffer
+	Rejected bytes.Buffer
+	Quality  QualityReport
+	// Digest covers every streamed row, archived and rejected alike.
+	Digest PartitionDigest
+	// rejectedAt holds the stream positions of the rejected rows, so the
+	// two files can be read back in export order.
+	rejectedAt []int64
+}
+
+type GetDataHisPricingFunc func(ctx context.Context, logger *zap.Logger, partition Partition) (ExportResult, error)
+
+func GetDataHisPricing(db *pgxpool.Pool, cfg *config.Config) GetDataHisPricingFunc {
+	return func(ctx context.Context, logger *zap.Logger, partition Partition) (ExportResult, error) {
+		partitions := partition.Name
+		checker, err := NewQualityChecker(cfg.Quality, partition)
+		if err != nil {
+			return ExportResult{}, err
+		}
+
+		tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+		if err != nil {
+			return ExportResult{}, err
 		}
 		defer func(tx pgx.Tx) {
 			_ = tx.Rollback(ctx)
 		}(tx)
 		sql := `
-						select 'unix_created_time' || ',' ||
-				'created_date' || ',' ||
-				'request_ref' || ',' ||
-				'buy_price' || ',' ||
-				'sell_price' || ',' ||
-				'request_time'
-				union  all
-				(select unix_created_time || ',' ||
-				created_date || ',' ||
-				request_ref || ',' ||
-				buy_price || ',' ||
-				sell_price || ',' ||
-				request_time
-				from his_pricing%s hp )
+				select unix_created_time::text,
+				created_date::text,
+				created_date,
+				request_ref::text,
+				buy_price::text,
+				sell_price::text,
+				request_time::text
+				from his_pricing%s hp
+				order by %s
 			`
 
-		sql = fmt.Sprintf(sql, partitions)
+		sql = fmt.Sprintf(sql, partitions, digestKey)
 
 		rows, err := tx.Query(ctx, sql)
+		if err != nil {
+			return ExportResult{}, err
+		}
 		defer rows.Close()
 
-		i := 0
 		start := time.Now()
 		logger.Info("start ", zap.Time("time", start))
 		csvBuffer := &bytes.Buffer{}
 		csvWriter := csv.NewWriter(csvBuffer)
+		if err := csvWriter.Write(hisPricingColumns); err != nil {
+			return ExportResult{}, err
+		}
+		digest := newDigestWriter()
+		rejectedBuffer := &bytes.Buffer{}
+		rejectedWriter := csv.NewWriter(rejectedBuffer)
+		if err := rejectedWriter.Write(append(append([]string{}, hisPricingColumns...), "violations")); err != nil {
+			return ExportResult{}, err
+		}
+		var rejectedAt []int64
 		for rows.Next() {
-			//startProcess := time.Now()
-			var temp string
-			err := rows.Scan(&temp)
+			var row hisPricingRow
+			err := rows.Scan(
+				&row.UnixCreatedTime,
+				&row.CreatedDateText,
+				&row.CreatedDate,
+				&row.RequestRef,
+				&row.BuyPrice,
+				&row.SellPrice,
+				&row.RequestTime,
+			)
 			if err != nil {
 				logger.Error("Error scanning  row", zap.Any("", err.Error()))
+				return ExportResult{}, err
+			}
+			record := row.record()
+			position := digest.rows
+			digest.Add(record)
+			if violated := checker.Check(row); len(violated) > 0 {
+				rejectedAt = append(rejectedAt, position)
+				if err := rejectedWriter.Write(append(record, strings.Join(violated, "|"))); err != nil {
+					logger.Error("Error writing rejected row", zap.Error(err))
+					return ExportResult{}, err
+				}
+				continue
 			}
-			fields := strings.Split(temp, ",")
-			_ = csvWriter.Write(fields)
-			i++
-			//if i%200000 == 0 {
-			//	duration := time.Since(startProcess)
-			//	logger.Debug("time use : ", zap.Any(strconv.Itoa(i), duration.Seconds()))
-			//	//fmt.Print(i, " time use:", duration.Seconds(), "s  ")
-			//}
+			if err := csvWriter.Write(record); err != nil {
+				logger.Error("Error writing CSV row", zap.Error(err))
+				return ExportResult{}, err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			logger.Error("Error reading rows", zap.Error(err))
+			return ExportResult{}, err
 		}
 
 		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			logger.Error("Error flushing CSV", zap.Error(err))
+			return ExportResult{}, err
+		}
+		rejectedWriter.Flush()
+		if err := rejectedWriter.Error(); err != nil {
+			logger.Error("Error flushing rejected rows", zap.Error(err))
+			return ExportResult{}, err
+		}
 		zipBuffer := &bytes.Buffer{}
 		zipWriter := zip.NewWriter(zipBuffer)
 
@@ -187,26 +274,32 @@ func GetDataHisPricing(db *pgxpool.Pool) GetDataHisPricingFunc {
 		csvFile, err := zipWriter.Create(csvFileName)
 		if err != nil {
 			logger.Error("Error creating CSV file in zip archive:", zap.Error(err))
-			return bytes.Buffer{}, err
+			return ExportResult{}, err
 		}
 		_, err = csvFile.Write(csvBuffer.Bytes())
 		if err != nil {
 			logger.Error("Error writing CSV data to zip archive:", zap.Error(err))
-			return bytes.Buffer{}, err
+			return ExportResult{}, err
 		}
 
 		err = zipWriter.Close()
 		if err != nil {
 			logger.Error("Error closing zip archive:", zap.Error(err))
-			return bytes.Buffer{}, err
+			return ExportResult{}, err
 		}
 		duration := time.Since(start)
 
 		defer func() {
 			csvBuffer.Reset()
 		}()
-		logger.Info(fmt.Sprintf("his_pricing%s time to use : %s s", partitions, duration.Seconds()))
-		return *zipBuffer, nil
+		logger.Info(fmt.Sprintf("his_pricing%s time to use : %f s", partitions, duration.Seconds()))
+		return ExportResult{
+			Archive:    *zipBuffer,
+			Rejected:   *rejectedBuffer,
+			Quality:    checker.Report(),
+			Digest:     digest.Digest(),
+			rejectedAt: rejectedAt,
+		}, nil
 	}
 
 }
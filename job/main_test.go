@@ -0,0 +1,14 @@
+package job
+
+import (
+	"os"
+	"testing"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/logz"
+)
+
+// TestMain sets up the package logger the job entry points log through.
+func TestMain(m *testing.M) {
+	logz.Init(logz.Fatal, "job-test")
+	os.Exit(m.Run())
+}
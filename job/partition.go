@@ -0,0 +1,223 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+)
+
+const (
+	PartitionMonthly = "monthly"
+	PartitionWeekly  = "weekly"
+	PartitionDaily   = "daily"
+)
+
+// Partition is one child table of his_pricing. Start is inclusive and End is
+// exclusive, both in the planner's location.
+type Partition struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+type PartitionPlanner struct {
+	Scheme   string
+	Location *time.Location
+}
+
+func NewPartitionPlanner(scheme string, loc *time.Location) (PartitionPlanner, error) {
+	if scheme == "" {
+		scheme = PartitionMonthly
+	}
+	scheme = strings.ToLower(scheme)
+	switch scheme {
+	case PartitionMonthly, PartitionWeekly, PartitionDaily:
+	default:
+		return PartitionPlanner{}, fmt.Errorf("unknown partition scheme %q, expected monthly, weekly or daily", scheme)
+	}
+	if loc == nil {
+		return PartitionPlanner{}, fmt.Errorf("partition planner requires a location")
+	}
+	return PartitionPlanner{Scheme: scheme, Location: loc}, nil
+}
+
+// At returns the partition containing t.
+func (p PartitionPlanner) At(t time.Time) Partition {
+	t = t.In(p.Location)
+	var start time.Time
+	switch p.Scheme {
+	case PartitionDaily:
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, p.Location)
+	case PartitionWeekly:
+		offset := (int(t.Weekday()) + 6) % 7
+		start = time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, p.Location)
+	default:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, p.Location)
+	}
+	return p.partition(start)
+}
+
+func (p PartitionPlanner) Next(partition Partition) Partition {
+	return p.partition(partition.End)
+}
+
+func (p PartitionPlanner) Prev(partition Partition) Partition {
+	return p.At(partition.Start.AddDate(0, 0, -1))
+}
+
+// Range returns every partition from the one containing from up to and
+// including the one containing to.
+func (p PartitionPlanner) Range(from, to time.Time) ([]Partition, error) {
+	first, last := p.At(from), p.At(to)
+	if first.Start.After(last.Start) {
+		return nil, fmt.Errorf("partition range start %s is after end %s", first.Name, last.Name)
+	}
+	var partitions []Partition
+	for current := first; !current.Start.After(last.Start); current = p.Next(current) {
+		partitions = append(partitions, current)
+	}
+	return partitions, nil
+}
+
+// Previous returns the n partitions before the one containing now, oldest first.
+func (p PartitionPlanner) Previous(n int, now time.Time) ([]Partition, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("number of previous partitions must be positive, got %d", n)
+	}
+	partitions := make([]Partition, n)
+	current := p.At(now)
+	for i := n - 1; i >= 0; i-- {
+		current = p.Prev(current)
+		partitions[i] = current
+	}
+	return partitions, nil
+}
+
+// Parse turns a partition name such as "_y2024m04" back into a Partition.
+func (p PartitionPlanner) Parse(name string) (Partition, error) {
+	switch p.Scheme {
+	case PartitionDaily:
+		t, err := time.ParseInLocation("_y2006m01d02", name, p.Location)
+		if err != nil {
+			return Partition{}, fmt.Errorf("invalid daily partition %q: %w", name, err)
+		}
+		return p.At(t), nil
+	case PartitionWeekly:
+		var year, week int
+		if _, err := fmt.Sscanf(name, "_y%04dw%02d", &year, &week); err != nil || week < 1 || week > 53 {
+			return Partition{}, fmt.Errorf("invalid weekly partition %q", name)
+		}
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, p.Location)
+		partition := p.At(jan4.AddDate(0, 0, (week-1)*7))
+		if partition.Name != name {
+			return Partition{}, fmt.Errorf("invalid weekly partition %q", name)
+		}
+		return partition, nil
+	default:
+		t, err := time.ParseInLocation("_y2006m01", name, p.Location)
+		if err != nil {
+			return Partition{}, fmt.Errorf("invalid monthly partition %q: %w", name, err)
+		}
+		return p.At(t), nil
+	}
+}
+
+// Gaps returns the partitions missing from the oldest of names up to and
+// including last, the newest partition that should exist. With no names,
+// last itself is missing. Names that do not parse under the planner's scheme
+// are left to the caller to report.
+func (p PartitionPlanner) Gaps(names []string, last Partition) []string {
+	gaps := []string{}
+	seen := map[string]bool{}
+	first := last
+	for _, name := range names {
+		partition, err := p.Parse(name)
+		if err != nil {
+			continue
+		}
+		seen[partition.Name] = true
+		if partition.Start.Before(first.Start) {
+			first = partition
+		}
+	}
+
+	for current := first; !current.Start.After(last.Start); current = p.Next(current) {
+		if !seen[current.Name] {
+			gaps = append(gaps, current.Name)
+		}
+	}
+	return gaps
+}
+
+func (p PartitionPlanner) partition(start time.Time) Partition {
+	switch p.Scheme {
+	case PartitionDaily:
+		return Partition{Name: start.Format("_y2006m01d02"), Start: start, End: start.AddDate(0, 0, 1)}
+	case PartitionWeekly:
+		year, week := start.ISOWeek()
+		return Partition{Name: fmt.Sprintf("_y%04dw%02d", year, week), Start: start, End: start.AddDate(0, 0, 7)}
+	default:
+		return Partition{Name: start.Format("_y2006m01"), Start: start, End: start.AddDate(0, 1, 0)}
+	}
+}
+
+// PlanPartitions resolves the configured partitions to archive. With no
+// range configured it plans the previous N partitions (default one).
+func PlanPartitions(cfg config.PartitionConfig, loc *time.Location, now time.Time) ([]Partition, error) {
+	planner, err := NewPartitionPlanner(cfg.Scheme, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.From == "" {
+		if cfg.To != "" {
+			return nil, fmt.Errorf("partition to %q requires partition from", cfg.To)
+		}
+		if cfg.Count != 0 {
+			return nil, fmt.Errorf("partition count %d requires partition from", cfg.Count)
+		}
+		previous := cfg.Previous
+		if previous == 0 {
+			previous = 1
+		}
+		return planner.Previous(previous, now)
+	}
+
+	if cfg.Previous != 0 {
+		return nil, fmt.Errorf("partition previous cannot be combined with partition from")
+	}
+	from, err := parsePartitionDate(cfg.From, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid partition from: %w", err)
+	}
+
+	switch {
+	case cfg.To != "" && cfg.Count != 0:
+		return nil, fmt.Errorf("partition to and partition count are mutually exclusive")
+	case cfg.To != "":
+		to, err := parsePartitionDate(cfg.To, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition to: %w", err)
+		}
+		return planner.Range(from, to)
+	case cfg.Count > 0:
+		partitions := []Partition{planner.At(from)}
+		for len(partitions) < cfg.Count {
+			partitions = append(partitions, planner.Next(partitions[len(partitions)-1]))
+		}
+		return partitions, nil
+	default:
+		return nil, fmt.Errorf("partition from %q requires partition to or a positive partition count, got count %d", cfg.From, cfg.Count)
+	}
+}
+
+func parsePartitionDate(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not in the form 2006-01-02 or 2006-01", value)
+}
@@ -0,0 +1,163 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+)
+
+func partitionNames(partitions []Partition) []string {
+	names := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		names = append(names, partition.Name)
+	}
+	return names
+}
+
+func TestPlanPartitions(t *testing.T) {
+	bangkok, err := time.LoadLocation("Asia/Bangkok")
+	assert.Equal(t, nil, err)
+
+	// 2024-04-30 18:30 UTC is already 2024-05-01 01:30 in Bangkok.
+	now := time.Date(2024, time.April, 30, 18, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		cfg     config.PartitionConfig
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "default is previous month in Bangkok",
+			cfg:  config.PartitionConfig{},
+			want: []string{"_y2024m04"},
+		},
+		{
+			name: "previous three months oldest first",
+			cfg:  config.PartitionConfig{Previous: 3},
+			want: []string{"_y2024m02", "_y2024m03", "_y2024m04"},
+		},
+		{
+			name: "inclusive month range",
+			cfg:  config.PartitionConfig{From: "2023-11", To: "2024-02"},
+			want: []string{"_y2023m11", "_y2023m12", "_y2024m01", "_y2024m02"},
+		},
+		{
+			name: "legacy start and count from the end of a month",
+			cfg:  config.PartitionConfig{From: "2024-01-31", Count: 3},
+			want: []string{"_y2024m01", "_y2024m02", "_y2024m03"},
+		},
+		{
+			name: "daily range over a leap day",
+			cfg:  config.PartitionConfig{Scheme: "daily", From: "2024-02-28", To: "2024-03-01"},
+			want: []string{"_y2024m02d28", "_y2024m02d29", "_y2024m03d01"},
+		},
+		{
+			name: "weekly range uses ISO weeks",
+			cfg:  config.PartitionConfig{Scheme: "weekly", From: "2023-12-27", To: "2024-01-10"},
+			want: []string{"_y2023w52", "_y2024w01", "_y2024w02"},
+		},
+		{
+			name: "previous daily partition",
+			cfg:  config.PartitionConfig{Scheme: "daily", Previous: 1},
+			want: []string{"_y2024m04d30"},
+		},
+		{
+			name:    "from without to or count",
+			cfg:     config.PartitionConfig{From: "2024-01-01"},
+			wantErr: `partition from "2024-01-01" requires partition to or a positive partition count, got count 0`,
+		},
+		{
+			name:    "unparsable from",
+			cfg:     config.PartitionConfig{From: "01/2024", Count: 1},
+			wantErr: `invalid partition from: "01/2024" is not in the form 2006-01-02 or 2006-01`,
+		},
+		{
+			name:    "from after to",
+			cfg:     config.PartitionConfig{From: "2024-03", To: "2024-01"},
+			wantErr: "partition range start _y2024m03 is after end _y2024m01",
+		},
+		{
+			name:    "to without from",
+			cfg:     config.PartitionConfig{To: "2024-03"},
+			wantErr: `partition to "2024-03" requires partition from`,
+		},
+		{
+			name:    "previous with from",
+			cfg:     config.PartitionConfig{From: "2024-03", Count: 1, Previous: 2},
+			wantErr: "partition previous cannot be combined with partition from",
+		},
+		{
+			name:    "to and count together",
+			cfg:     config.PartitionConfig{From: "2024-01", To: "2024-03", Count: 2},
+			wantErr: "partition to and partition count are mutually exclusive",
+		},
+		{
+			name:    "negative previous",
+			cfg:     config.PartitionConfig{Previous: -1},
+			wantErr: "number of previous partitions must be positive, got -1",
+		},
+		{
+			name:    "unknown scheme",
+			cfg:     config.PartitionConfig{Scheme: "yearly"},
+			wantErr: `unknown partition scheme "yearly", expected monthly, weekly or daily`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partitions, err := PlanPartitions(tt.cfg, bangkok, now)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.want, partitionNames(partitions))
+			for _, partition := range partitions {
+				assert.Equal(t, bangkok, partition.Start.Location())
+			}
+		})
+	}
+}
+
+func TestPartitionPlannerParseAndGaps(t *testing.T) {
+	bangkok, err := time.LoadLocation("Asia/Bangkok")
+	assert.Equal(t, nil, err)
+
+	tests := []struct {
+		name   string
+		scheme string
+		names  []string
+		last   string
+		gaps   []string
+	}{
+		{name: "between", scheme: "monthly", names: []string{"_y2024m03", "_y2023m12", "_y2024m01"}, last: "_y2024m03", gaps: []string{"_y2024m02"}},
+		{name: "recent missing", scheme: "monthly", names: []string{"_y2024m01", "_y2024m01", "bogus"}, last: "_y2024m03", gaps: []string{"_y2024m02", "_y2024m03"}},
+		{name: "newer than last", scheme: "monthly", names: []string{"_y2024m01", "_y2024m04"}, last: "_y2024m02", gaps: []string{"_y2024m02"}},
+		{name: "none", scheme: "monthly", names: []string{"bogus"}, last: "_y2024m03", gaps: []string{"_y2024m03"}},
+		{name: "daily", scheme: "daily", names: []string{"_y2024m02d27", "_y2024m03d01"}, last: "_y2024m03d01", gaps: []string{"_y2024m02d28", "_y2024m02d29"}},
+		{name: "weekly", scheme: "weekly", names: []string{"_y2023w51", "_y2024w02"}, last: "_y2024w02", gaps: []string{"_y2023w52", "_y2024w01"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner, err := NewPartitionPlanner(tt.scheme, bangkok)
+			assert.Equal(t, nil, err)
+			last, err := planner.Parse(tt.last)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.gaps, planner.Gaps(tt.names, last))
+		})
+	}
+
+	planner, _ := NewPartitionPlanner("monthly", bangkok)
+	partition, err := planner.Parse("_y2024m02")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Date(2024, time.February, 1, 0, 0, 0, 0, bangkok), partition.Start)
+	assert.Equal(t, time.Date(2024, time.March, 1, 0, 0, 0, 0, bangkok), partition.End)
+
+	weekly, _ := NewPartitionPlanner("weekly", bangkok)
+	_, err = weekly.Parse("_y2023w53")
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,186 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+)
+
+const (
+	QualityRuleRequired      = "required"
+	QualityRulePriceSpread   = "price_spread"
+	QualityRuleCreatedDate   = "created_date_bounds"
+	QualityRuleDuplicatedRef = "duplicate_request_ref"
+)
+
+var ErrQualityThreshold = errors.New("data quality threshold exceeded")
+
+var hisPricingColumns = []string{
+	"unix_created_time",
+	"created_date",
+	"request_ref",
+	"buy_price",
+	"sell_price",
+	"request_time",
+}
+
+// hisPricingRow keeps every column nullable so a bad row is reported by the
+// quality rules instead of failing the scan.
+type hisPricingRow struct {
+	UnixCreatedTime *string
+	CreatedDateText *string
+	CreatedDate     *time.Time
+	RequestRef      *string
+	BuyPrice        *string
+	SellPrice       *string
+	RequestTime     *string
+}
+
+func (r hisPricingRow) column(name string) *string {
+	switch name {
+	case "unix_created_time":
+		return r.UnixCreatedTime
+	case "created_date":
+		return r.CreatedDateText
+	case "request_ref":
+		return r.RequestRef
+	case "buy_price":
+		return r.BuyPrice
+	case "sell_price":
+		return r.SellPrice
+	case "request_time":
+		return r.RequestTime
+	}
+	return nil
+}
+
+func (r hisPricingRow) record() []string {
+	record := make([]string, len(hisPricingColumns))
+	for i, name := range hisPricingColumns {
+		if value := r.column(name); value != nil {
+			record[i] = *value
+		}
+	}
+	return record
+}
+
+type QualityReport struct {
+	Partition    string         `json:"partition"`
+	Rows         int            `json:"rows"`
+	RejectedRows int            `json:"rejectedRows"`
+	Violations   map[string]int `json:"violations"`
+	Failed       bool           `json:"failed"`
+}
+
+type QualityChecker struct {
+	rules      []string
+	required   []string
+	partition  Partition
+	maxRejects int
+	seenRefs   map[string]bool
+	report     QualityReport
+}
+
+func NewQualityChecker(cfg config.QualityConfig, partition Partition) (*QualityChecker, error) {
+	for _, rule := range cfg.Rules {
+		switch rule {
+		case QualityRuleRequired, QualityRulePriceSpread, QualityRuleCreatedDate, QualityRuleDuplicatedRef:
+		default:
+			return nil, fmt.Errorf("unknown quality rule %q", rule)
+		}
+	}
+	for _, column := range cfg.RequiredColumns {
+		if !containsString(hisPricingColumns, column) {
+			return nil, fmt.Errorf("unknown required column %q", column)
+		}
+	}
+
+	return &QualityChecker{
+		rules:      cfg.Rules,
+		required:   cfg.RequiredColumns,
+		partition:  partition,
+		maxRejects: cfg.MaxRejectedRows,
+		seenRefs:   map[string]bool{},
+		report: QualityReport{
+			Partition:  partition.Name,
+			Violations: map[string]int{},
+		},
+	}, nil
+}
+
+// Check returns the rules the row violates, or nil when the row is clean.
+func (c *QualityChecker) Check(row hisPricingRow) []string {
+	var violated []string
+	for _, rule := range c.rules {
+		if !c.passes(rule, row) {
+			violated = append(violated, rule)
+			c.report.Violations[rule]++
+		}
+	}
+
+	c.report.Rows++
+	if len(violated) > 0 {
+		c.report.RejectedRows++
+	}
+	return violated
+}
+
+// Report returns the counts so far. A negative MaxRejectedRows never fails.
+func (c *QualityChecker) Report() QualityReport {
+	report := c.report
+	report.Failed = c.maxRejects >= 0 && report.RejectedRows > c.maxRejects
+	return report
+}
+
+func (c *QualityChecker) passes(rule string, row hisPricingRow) bool {
+	switch rule {
+	case QualityRuleRequired:
+		for _, column := range c.required {
+			if value := row.column(column); value == nil || strings.TrimSpace(*value) == "" {
+				return false
+			}
+		}
+		return true
+	case QualityRulePriceSpread:
+		if row.BuyPrice == nil || row.SellPrice == nil {
+			return false
+		}
+		buy, err := decimal.NewFromString(*row.BuyPrice)
+		if err != nil {
+			return false
+		}
+		sell, err := decimal.NewFromString(*row.SellPrice)
+		if err != nil {
+			return false
+		}
+		return sell.GreaterThanOrEqual(buy)
+	case QualityRuleCreatedDate:
+		if row.CreatedDate == nil {
+			return false
+		}
+		return !row.CreatedDate.Before(c.partition.Start) && row.CreatedDate.Before(c.partition.End)
+	case QualityRuleDuplicatedRef:
+		if row.RequestRef == nil {
+			return true
+		}
+		if c.seenRefs[*row.RequestRef] {
+			return false
+		}
+		c.seenRefs[*row.RequestRef] = true
+		return true
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestQualityChecker(t *testing.T) {
+	bangkok, err := time.LoadLocation("Asia/Bangkok")
+	assert.Equal(t, nil, err)
+	planner, _ := NewPartitionPlanner(PartitionMonthly, bangkok)
+	partition, _ := planner.Parse("_y2024m04")
+
+	inside := time.Date(2024, time.April, 10, 9, 0, 0, 0, bangkok)
+	outside := time.Date(2024, time.May, 1, 0, 0, 0, 0, bangkok)
+	row := func(ref, buy, sell string, created time.Time) hisPricingRow {
+		text := created.Format("2006-01-02 15:04:05")
+		return hisPricingRow{
+			CreatedDateText: &text,
+			CreatedDate:     &created,
+			RequestRef:      strPtr(ref),
+			BuyPrice:        strPtr(buy),
+			SellPrice:       strPtr(sell),
+		}
+	}
+
+	checker, err := NewQualityChecker(config.QualityConfig{
+		Rules:           []string{QualityRuleRequired, QualityRulePriceSpread, QualityRuleCreatedDate, QualityRuleDuplicatedRef},
+		RequiredColumns: []string{"request_ref", "buy_price", "sell_price"},
+		MaxRejectedRows: 2,
+	}, partition)
+	assert.Equal(t, nil, err)
+
+	tests := []struct {
+		name string
+		row  hisPricingRow
+		want []string
+	}{
+		{name: "clean", row: row("R1", "100.50", "101.00", inside), want: nil},
+		{name: "equal prices", row: row("R2", "100", "100.00", inside), want: nil},
+		{name: "sell below buy", row: row("R3", "101", "100", inside), want: []string{QualityRulePriceSpread}},
+		{name: "outside partition", row: row("R4", "1", "2", outside), want: []string{QualityRuleCreatedDate}},
+		{name: "duplicate ref", row: row("R1", "1", "2", inside), want: []string{QualityRuleDuplicatedRef}},
+		{name: "missing price", row: hisPricingRow{RequestRef: strPtr("R5"), CreatedDate: &inside}, want: []string{QualityRuleRequired, QualityRulePriceSpread}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, checker.Check(tt.row))
+		})
+	}
+
+	report := checker.Report()
+	assert.Equal(t, 6, report.Rows)
+	assert.Equal(t, 4, report.RejectedRows)
+	assert.Equal(t, map[string]int{
+		QualityRulePriceSpread:   2,
+		QualityRuleCreatedDate:   1,
+		QualityRuleDuplicatedRef: 1,
+		QualityRuleRequired:      1,
+	}, report.Violations)
+	assert.Equal(t, true, report.Failed)
+
+	_, err = NewQualityChecker(config.QualityConfig{Rules: []string{"unknown"}}, partition)
+	assert.EqualError(t, err, `unknown quality rule "unknown"`)
+}
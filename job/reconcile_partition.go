@@ -0,0 +1,226 @@
+package job
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+var ErrReconcileMismatch = errors.New("partition reconciliation mismatch")
+
+// digestKey is shared by the source aggregate and the export ordering so both
+// sides hash rows in the same order.
+const digestKey = `coalesce(request_ref::text, '') || ':' || coalesce(buy_price::text, '') || ':' || coalesce(sell_price::text, '')`
+
+const maxDiffLogged = 50
+
+// PartitionDigest is the row count plus an ordered md5 over request_ref and
+// prices, comparable between the source partition and the exported CSV.
+type PartitionDigest struct {
+	Rows int64  `json:"rows"`
+	MD5  string `json:"md5"`
+}
+
+type digestWriter struct {
+	hash hash.Hash
+	rows int64
+	refs map[string]int64
+}
+
+func newDigestWriter() *digestWriter {
+	return &digestWriter{hash: md5.New(), refs: map[string]int64{}}
+}
+
+func (d *digestWriter) Add(record []string) {
+	ref, buy, sell := record[2], record[3], record[4]
+	if d.rows > 0 {
+		d.hash.Write([]byte(","))
+	}
+	d.hash.Write([]byte(ref + ":" + buy + ":" + sell))
+	d.rows++
+	d.refs[ref]++
+}
+
+func (d *digestWriter) Digest() PartitionDigest {
+	return PartitionDigest{Rows: d.rows, MD5: hex.EncodeToString(d.hash.Sum(nil))}
+}
+
+// readBackDigest digests the rows as they were written: the CSV inside the
+// zipped archive and the rejected-rows CSV, merged back into export order
+// using the positions in rejectedAt.
+func readBackDigest(archive, rejected []byte, rejectedAt []int64) (*digestWriter, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	if len(zipReader.File) != 1 {
+		return nil, fmt.Errorf("expected one file in archive, found %d", len(zipReader.File))
+	}
+	csvFile, err := zipReader.File[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+
+	archiveReader := csv.NewReader(csvFile)
+	rejectedReader := csv.NewReader(bytes.NewReader(rejected))
+	rejectedReader.FieldsPerRecord = len(hisPricingColumns) + 1
+	for _, reader := range []*csv.Reader{archiveReader, rejectedReader} {
+		if _, err := reader.Read(); err != nil {
+			return nil, fmt.Errorf("reading CSV header: %w", err)
+		}
+	}
+
+	digest := newDigestWriter()
+	next := 0
+	for {
+		reader := archiveReader
+		if next < len(rejectedAt) && rejectedAt[next] == digest.rows {
+			reader = rejectedReader
+			next++
+		}
+		record, err := reader.Read()
+		if err == io.EOF && reader == archiveReader {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		digest.Add(record)
+	}
+	// Rejected rows past the end of a short archive still count.
+	for {
+		record, err := rejectedReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		digest.Add(record)
+	}
+	return digest, nil
+}
+
+type GetSourceDigestFunc func(ctx context.Context, logger *zap.Logger, partition Partition) (PartitionDigest, error)
+
+func GetSourceDigest(db *pgxpool.Pool) GetSourceDigestFunc {
+	return func(ctx context.Context, logger *zap.Logger, partition Partition) (PartitionDigest, error) {
+		sql := `
+				select count(*),
+				coalesce(md5(string_agg(%[2]s, ',' order by %[2]s)), md5(''))
+				from his_pricing%[1]s hp
+			`
+		sql = fmt.Sprintf(sql, partition.Name, digestKey)
+
+		var digest PartitionDigest
+		if err := db.QueryRow(ctx, sql).Scan(&digest.Rows, &digest.MD5); err != nil {
+			return PartitionDigest{}, err
+		}
+		return digest, nil
+	}
+}
+
+type ReconcilePartitionFunc func(ctx context.Context, logger *zap.Logger, partition Partition, export ExportResult) error
+
+// ReconcilePartition downloads the uploaded archive and compares the rows read
+// back from it and the rejected-rows file with the source partition. On
+// mismatch it logs which request_refs differ and returns ErrReconcileMismatch.
+func ReconcilePartition(db *pgxpool.Pool, GetSourceDigestFunc GetSourceDigestFunc, DownloadArchiveFunc DownloadArchiveFunc) ReconcilePartitionFunc {
+	return func(ctx context.Context, logger *zap.Logger, partition Partition, export ExportResult) error {
+		source, err := GetSourceDigestFunc(ctx, logger, partition)
+		if err != nil {
+			return err
+		}
+
+		_, archive, err := DownloadArchiveFunc(ctx, logger, partition.Name)
+		if err != nil {
+			return err
+		}
+		stored, err := readBackDigest(archive, export.Rejected.Bytes(), export.rejectedAt)
+		if err != nil {
+			logger.Error("Error reading back archive", zap.String("partition", partition.Name), zap.Error(err))
+			return fmt.Errorf("%w: partition %s: %v", ErrReconcileMismatch, partition.Name, err)
+		}
+		digest := stored.Digest()
+
+		if source == digest {
+			logger.Info("partition reconciled",
+				zap.String("partition", partition.Name),
+				zap.Int64("rows", source.Rows),
+				zap.String("md5", source.MD5),
+			)
+			return nil
+		}
+
+		logger.Error("partition reconciliation mismatch",
+			zap.String("partition", partition.Name),
+			zap.Int64("sourceRows", source.Rows),
+			zap.Int64("archiveRows", digest.Rows),
+			zap.String("sourceMD5", source.MD5),
+			zap.String("archiveMD5", digest.MD5),
+			zap.Int("rejectedRows", export.Quality.RejectedRows),
+		)
+
+		sql := `select coalesce(request_ref::text, ''), count(*) from his_pricing%s hp group by 1`
+		rows, err := db.Query(ctx, fmt.Sprintf(sql, partition.Name))
+		if err != nil {
+			logger.Error("Error querying request_ref diff", zap.Error(err))
+			return fmt.Errorf("%w: partition %s", ErrReconcileMismatch, partition.Name)
+		}
+		defer rows.Close()
+
+		sourceRefs := map[string]int64{}
+		for rows.Next() {
+			var ref string
+			var count int64
+			if err := rows.Scan(&ref, &count); err != nil {
+				logger.Error("Error scanning request_ref diff", zap.Error(err))
+				break
+			}
+			sourceRefs[ref] = count
+		}
+
+		diffs := diffRefCounts(sourceRefs, stored.refs)
+		for i, diff := range diffs {
+			if i == maxDiffLogged {
+				logger.Error("request_ref diff truncated", zap.Int("remaining", len(diffs)-maxDiffLogged))
+				break
+			}
+			logger.Error("request_ref diff", zap.String("partition", partition.Name), zap.String("diff", diff))
+		}
+		if len(diffs) == 0 {
+			logger.Error("request_ref counts match, prices or ordering differ", zap.String("partition", partition.Name))
+		}
+
+		return fmt.Errorf("%w: partition %s source %d rows %s, archive %d rows %s",
+			ErrReconcileMismatch, partition.Name, source.Rows, source.MD5, digest.Rows, digest.MD5)
+	}
+}
+
+func diffRefCounts(source, archive map[string]int64) []string {
+	var diffs []string
+	for ref, count := range source {
+		if archive[ref] != count {
+			diffs = append(diffs, fmt.Sprintf("%q source=%d archive=%d", ref, count, archive[ref]))
+		}
+	}
+	for ref, count := range archive {
+		if _, ok := source[ref]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%q source=0 archive=%d", ref, count))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
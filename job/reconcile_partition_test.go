@@ -0,0 +1,125 @@
+package job
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDigestWriterMatchesStringAgg(t *testing.T) {
+	md5Hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	empty := newDigestWriter()
+	// coalesce(md5(string_agg(...)), md5('')) for an empty partition
+	assert.Equal(t, PartitionDigest{Rows: 0, MD5: md5Hex("")}, empty.Digest())
+
+	digest := newDigestWriter()
+	digest.Add([]string{"1712000000", "2024-04-01 10:00:00", "R1", "100.50", "101.00", ""})
+	digest.Add([]string{"1712000001", "", "", "", "99", ""})
+	assert.Equal(t, PartitionDigest{Rows: 2, MD5: md5Hex("R1:100.50:101.00,::99")}, digest.Digest())
+
+	assert.Equal(t, []string{
+		`"R1" source=1 archive=0`,
+		`"R2" source=0 archive=1`,
+		`"R3" source=2 archive=1`,
+	}, diffRefCounts(map[string]int64{"R1": 1, "R3": 2, "R4": 1}, map[string]int64{"R2": 1, "R3": 1, "R4": 1}))
+}
+
+func zipCSV(t *testing.T, records [][]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buf)
+	file, err := zipWriter.Create("his_pricing_y2024m04.csv")
+	assert.Equal(t, nil, err)
+	csvWriter := csv.NewWriter(file)
+	assert.Equal(t, nil, csvWriter.WriteAll(append([][]string{hisPricingColumns}, records...)))
+	assert.Equal(t, nil, zipWriter.Close())
+	return buf.Bytes()
+}
+
+func TestReadBackDigest(t *testing.T) {
+	rows := [][]string{
+		{"1", "", "R1", "10", "11", ""},
+		{"2", "", "R2", "", "12", ""},
+		{"3", "", "R3", "13", "14", ""},
+	}
+	expected := newDigestWriter()
+	for _, row := range rows {
+		expected.Add(row)
+	}
+
+	rejected := &bytes.Buffer{}
+	rejectedWriter := csv.NewWriter(rejected)
+	_ = rejectedWriter.WriteAll([][]string{
+		append(append([]string{}, hisPricingColumns...), "violations"),
+		append(append([]string{}, rows[1]...), "required"),
+	})
+
+	cases := []struct {
+		name    string
+		archive [][]string
+		want    PartitionDigest
+	}{
+		{name: "complete", archive: [][]string{rows[0], rows[2]}, want: expected.Digest()},
+		{name: "truncated", archive: [][]string{rows[0]}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			digest, err := readBackDigest(zipCSV(t, tc.archive), rejected.Bytes(), []int64{1})
+			assert.Equal(t, nil, err)
+			if tc.want.MD5 != "" {
+				assert.Equal(t, tc.want, digest.Digest())
+			} else {
+				assert.NotEqual(t, expected.Digest(), digest.Digest())
+				assert.Equal(t, int64(2), digest.Digest().Rows)
+			}
+		})
+	}
+
+	_, err := readBackDigest([]byte("not a zip"), rejected.Bytes(), nil)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestBackUpHisPricingDetachesReconciledPartitions(t *testing.T) {
+	partitions := []Partition{{Name: "_y2024m03"}, {Name: "_y2024m04"}}
+	getData := func(ctx context.Context, logger *zap.Logger, partition Partition) (ExportResult, error) {
+		return ExportResult{}, nil
+	}
+	var calls []string
+	push := func(ctx context.Context, logger *zap.Logger, export ExportResult, partitions string) error {
+		calls = append(calls, "push"+partitions)
+		return nil
+	}
+	pushRejected := func(ctx context.Context, logger *zap.Logger, rejected bytes.Buffer, partitions string) error {
+		return nil
+	}
+	reconcile := func(ctx context.Context, logger *zap.Logger, partition Partition, export ExportResult) error {
+		calls = append(calls, "reconcile"+partition.Name)
+		if partition.Name == "_y2024m04" {
+			return ErrReconcileMismatch
+		}
+		return nil
+	}
+	detach := func(ctx context.Context, logger *zap.Logger, partition string) error {
+		calls = append(calls, "detach"+partition)
+		return nil
+	}
+
+	err := BackUpHisPricing(partitions, getData, push, pushRejected, reconcile, detach)
+	assert.Equal(t, true, errors.Is(err, ErrReconcileMismatch))
+	assert.Equal(t, []string{
+		"push_y2024m03", "reconcile_y2024m03", "detach_y2024m03",
+		"push_y2024m04", "reconcile_y2024m04",
+	}, calls)
+}
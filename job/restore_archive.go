@@ -0,0 +1,149 @@
+package job
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/logz"
+	"go.uber.org/zap"
+)
+
+var ErrRestoreTableNotEmpty = errors.New("restore table already has rows")
+
+func RestoreArchive(
+	cfg *config.Config,
+	partitions []Partition,
+	DownloadArchiveFunc DownloadArchiveFunc,
+	RestorePartitionFunc RestorePartitionFunc,
+) error {
+
+	logger := logz.NewLogger()
+	ctx := context.Background()
+
+	for _, partition := range partitions {
+		manifest, archive, err := DownloadArchiveFunc(ctx, logger, partition.Name)
+		if err != nil {
+			logger.Error("Error DownloadArchiveFunc", zap.Any("", err.Error()))
+			return err
+		}
+		table := fmt.Sprintf(cfg.Restore.Table, partition.Name)
+		rows, err := RestorePartitionFunc(ctx, logger, archive, table, manifest.ArchivedRows)
+		if err != nil {
+			logger.Error("Error RestorePartitionFunc", zap.Any("", err.Error()))
+			return err
+		}
+		logger.Info("partition restored", zap.String("partition", partition.Name), zap.String("table", table), zap.Int64("rows", rows))
+	}
+	return nil
+}
+
+// DownloadArchiveFunc fetches an archive and checks it against its manifest.
+type DownloadArchiveFunc func(ctx context.Context, logger *zap.Logger, partitions string) (*ArchiveManifest, []byte, error)
+
+func DownloadArchive(svc *s3.S3, cfg *config.Config, GetArchiveManifestFunc GetArchiveManifestFunc) DownloadArchiveFunc {
+	return func(ctx context.Context, logger *zap.Logger, partitions string) (*ArchiveManifest, []byte, error) {
+		key := ArchiveKey(cfg, partitions)
+		manifest, err := GetArchiveManifestFunc(ctx, logger, ManifestKey(key))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: &cfg.S3Config.BucketName,
+			Key:    &key,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		defer out.Body.Close()
+
+		archive, err := io.ReadAll(out.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		sum := sha256.Sum256(archive)
+		if hex.EncodeToString(sum[:]) != manifest.SHA256 {
+			return nil, nil, fmt.Errorf("%w: checksum of %s does not match manifest", ErrArchiveVerifyFailed, key)
+		}
+		return manifest, archive, nil
+	}
+}
+
+// RestorePartitionFunc loads the CSV inside an archive into table and returns
+// the number of rows copied. Nothing is kept unless exactly archivedRows rows
+// were copied; zero skips the check for manifests that predate the count.
+type RestorePartitionFunc func(ctx context.Context, logger *zap.Logger, archive []byte, table string, archivedRows int) (int64, error)
+
+// RestorePartition creates and fills table in one transaction. It refuses a
+// table that already has rows, so a rerun cannot append duplicates.
+func RestorePartition(db *pgxpool.Pool, cfg *config.Config) RestorePartitionFunc {
+	return func(ctx context.Context, logger *zap.Logger, archive []byte, table string, archivedRows int) (int64, error) {
+		zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return 0, err
+		}
+		if len(zipReader.File) != 1 {
+			return 0, fmt.Errorf("expected one file in archive, found %d", len(zipReader.File))
+		}
+		csvFile, err := zipReader.File[0].Open()
+		if err != nil {
+			return 0, err
+		}
+		defer csvFile.Close()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer func(tx pgx.Tx) {
+			_ = tx.Rollback(ctx)
+		}(tx)
+
+		identifier := pgx.Identifier{table}.Sanitize()
+		if cfg.Restore.Create {
+			sql := fmt.Sprintf(`create table if not exists %s (like his_pricing including defaults)`, identifier)
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				return 0, err
+			}
+		}
+
+		var filled bool
+		if err := tx.QueryRow(ctx, fmt.Sprintf(`select exists (select 1 from %s)`, identifier)).Scan(&filled); err != nil {
+			return 0, err
+		}
+		if filled {
+			return 0, fmt.Errorf("%w: %s", ErrRestoreTableNotEmpty, table)
+		}
+
+		sql := fmt.Sprintf(`copy %s (%s) from stdin with (format csv, header true)`, identifier, strings.Join(hisPricingColumns, ", "))
+		tag, err := tx.Conn().PgConn().CopyFrom(ctx, csvFile, sql)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkRestoredRows(table, tag.RowsAffected(), archivedRows); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, err
+		}
+		return tag.RowsAffected(), nil
+	}
+}
+
+func checkRestoredRows(table string, rows int64, archivedRows int) error {
+	if archivedRows != 0 && rows != int64(archivedRows) {
+		return fmt.Errorf("%w: restored %d rows into %s, manifest has %d", ErrArchiveVerifyFailed, rows, table, archivedRows)
+	}
+	return nil
+}
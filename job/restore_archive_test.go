@@ -0,0 +1,70 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+func TestRestoreArchive(t *testing.T) {
+	cfg := &config.Config{Restore: config.RestoreConfig{Table: "restored%s"}}
+	partitions := []Partition{{Name: "_y2024m03"}, {Name: "_y2024m04"}}
+	download := func(ctx context.Context, logger *zap.Logger, partitions string) (*ArchiveManifest, []byte, error) {
+		return &ArchiveManifest{Partition: partitions, ArchivedRows: 3}, []byte(partitions), nil
+	}
+
+	tests := []struct {
+		name   string
+		copied map[string]int64
+		tables []string
+		err    error
+	}{
+		{
+			name:   "restored",
+			copied: map[string]int64{"restored_y2024m03": 3, "restored_y2024m04": 3},
+			tables: []string{"restored_y2024m03", "restored_y2024m04"},
+		},
+		{
+			name:   "row count mismatch stops the run",
+			copied: map[string]int64{"restored_y2024m03": 2, "restored_y2024m04": 3},
+			tables: []string{"restored_y2024m03"},
+			err:    ErrArchiveVerifyFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tables []string
+			restore := func(ctx context.Context, logger *zap.Logger, archive []byte, table string, archivedRows int) (int64, error) {
+				tables = append(tables, table)
+				rows := tt.copied[table]
+				if err := checkRestoredRows(table, rows, archivedRows); err != nil {
+					return 0, err
+				}
+				return rows, nil
+			}
+			err := RestoreArchive(cfg, partitions, download, restore)
+			assert.Equal(t, true, errors.Is(err, tt.err), "err: %v", err)
+			assert.Equal(t, tt.tables, tables)
+		})
+	}
+
+	failedDownload := func(ctx context.Context, logger *zap.Logger, partitions string) (*ArchiveManifest, []byte, error) {
+		return nil, nil, ErrArchiveVerifyFailed
+	}
+	restore := func(ctx context.Context, logger *zap.Logger, archive []byte, table string, archivedRows int) (int64, error) {
+		t.Fatal("restored an archive that failed its checksum")
+		return 0, nil
+	}
+	assert.Equal(t, true, errors.Is(RestoreArchive(cfg, partitions, failedDownload, restore), ErrArchiveVerifyFailed))
+}
+
+func TestCheckRestoredRows(t *testing.T) {
+	assert.Equal(t, nil, checkRestoredRows("t", 3, 3))
+	// Manifests written before ArchivedRows existed carry zero.
+	assert.Equal(t, nil, checkRestoredRows("t", 3, 0))
+	assert.Equal(t, true, errors.Is(checkRestoredRows("t", 2, 3), ErrArchiveVerifyFailed))
+}
@@ -0,0 +1,101 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/logz"
+	"go.uber.org/zap"
+)
+
+const AuditIssueSourceMismatch = "SOURCE_MISMATCH"
+
+var ErrArchiveVerifyFailed = errors.New("archive verification failed")
+
+// VerifyArchive checks the archives of the given partitions against their
+// manifests. When GetSourceDigestFunc is not nil the manifest digest is also
+// compared with the partition still in the database.
+func VerifyArchive(
+	cfg *config.Config,
+	partitions []Partition,
+	GetArchiveManifestFunc GetArchiveManifestFunc,
+	VerifyArchiveObjectFunc VerifyArchiveObjectFunc,
+	GetSourceDigestFunc GetSourceDigestFunc,
+) ([]ArchiveAuditIssue, error) {
+
+	logger := logz.NewLogger()
+	ctx := context.Background()
+	issues := []ArchiveAuditIssue{}
+
+	for _, partition := range partitions {
+		key := ArchiveKey(cfg, partition.Name)
+		manifest, err := GetArchiveManifestFunc(ctx, logger, ManifestKey(key))
+		if err != nil {
+			kind := AuditIssueBadManifest
+			if isNotFound(err) {
+				kind = AuditIssueMissing
+			}
+			issues = append(issues, ArchiveAuditIssue{Partition: partition.Name, Key: key, Kind: kind, Detail: err.Error()})
+			continue
+		}
+
+		issue, err := VerifyArchiveObjectFunc(ctx, logger, *manifest)
+		if err != nil {
+			logger.Error("Error VerifyArchiveObjectFunc", zap.String("key", key), zap.Error(err))
+			return nil, err
+		}
+		if issue != nil {
+			issues = append(issues, *issue)
+			continue
+		}
+
+		if GetSourceDigestFunc != nil {
+			source, err := GetSourceDigestFunc(ctx, logger, partition)
+			if err != nil {
+				logger.Error("Error GetSourceDigestFunc", zap.String("partition", partition.Name), zap.Error(err))
+				return nil, err
+			}
+			if source != manifest.Source {
+				issues = append(issues, ArchiveAuditIssue{
+					Partition: partition.Name,
+					Key:       key,
+					Kind:      AuditIssueSourceMismatch,
+					Detail: fmt.Sprintf("source %d rows %s, manifest %d rows %s",
+						source.Rows, source.MD5, manifest.Source.Rows, manifest.Source.MD5),
+				})
+				continue
+			}
+		}
+		logger.Info("archive verified", zap.String("partition", partition.Name), zap.String("key", key))
+	}
+
+	for _, issue := range issues {
+		logger.Error("archive verification issue", zap.Any("issue", issue))
+	}
+	if len(issues) > 0 {
+		return issues, ErrArchiveVerifyFailed
+	}
+	return issues, nil
+}
+
+type ArchiveExistsFunc func(ctx context.Context, logger *zap.Logger, partitions string) (bool, error)
+
+func ArchiveExists(svc *s3.S3, cfg *config.Config) ArchiveExistsFunc {
+	return func(ctx context.Context, logger *zap.Logger, partitions string) (bool, error) {
+		key := ManifestKey(ArchiveKey(cfg, partitions))
+		_, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: &cfg.S3Config.BucketName,
+			Key:    &key,
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+}
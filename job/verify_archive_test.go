@@ -0,0 +1,81 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"go.uber.org/zap"
+)
+
+var archiveConfig = &config.Config{S3Config: config.S3Config{BucketName: "bucket", Key: "his_pricing/his_pricing%s.zip"}}
+
+func TestVerifyArchive(t *testing.T) {
+	digest := PartitionDigest{Rows: 3, MD5: "abc"}
+	getManifest := func(ctx context.Context, logger *zap.Logger, key string) (*ArchiveManifest, error) {
+		switch key {
+		case ManifestKey(ArchiveKey(archiveConfig, "_y2024m01")):
+			return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+		case ManifestKey(ArchiveKey(archiveConfig, "_y2024m02")):
+			return nil, errors.New("manifest is missing key or checksum")
+		}
+		return &ArchiveManifest{Key: key[:len(key)-len(manifestSuffix)], Source: digest}, nil
+	}
+	verifyObject := func(ctx context.Context, logger *zap.Logger, manifest ArchiveManifest) (*ArchiveAuditIssue, error) {
+		if manifest.Key == ArchiveKey(archiveConfig, "_y2024m03") {
+			return &ArchiveAuditIssue{Key: manifest.Key, Kind: AuditIssueChecksumMismatch}, nil
+		}
+		return nil, nil
+	}
+	sourceDigest := func(ctx context.Context, logger *zap.Logger, partition Partition) (PartitionDigest, error) {
+		if partition.Name == "_y2024m05" {
+			return PartitionDigest{Rows: 4, MD5: "def"}, nil
+		}
+		return digest, nil
+	}
+
+	kinds := func(issues []ArchiveAuditIssue) map[string]string {
+		found := map[string]string{}
+		for _, issue := range issues {
+			found[issue.Key] = issue.Kind
+		}
+		return found
+	}
+
+	tests := []struct {
+		name      string
+		partition string
+		source    GetSourceDigestFunc
+		kind      string
+	}{
+		{name: "missing", partition: "_y2024m01", kind: AuditIssueMissing},
+		{name: "bad manifest", partition: "_y2024m02", kind: AuditIssueBadManifest},
+		{name: "checksum mismatch", partition: "_y2024m03", kind: AuditIssueChecksumMismatch},
+		{name: "healthy", partition: "_y2024m04", source: sourceDigest},
+		{name: "source mismatch", partition: "_y2024m05", source: sourceDigest, kind: AuditIssueSourceMismatch},
+		{name: "source not checked", partition: "_y2024m05"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := VerifyArchive(archiveConfig, []Partition{{Name: tt.partition}}, getManifest, verifyObject, tt.source)
+			if tt.kind == "" {
+				assert.Equal(t, nil, err)
+				assert.Equal(t, 0, len(issues))
+				return
+			}
+			assert.Equal(t, true, errors.Is(err, ErrArchiveVerifyFailed))
+			assert.Equal(t, map[string]string{ArchiveKey(archiveConfig, tt.partition): tt.kind}, kinds(issues))
+		})
+	}
+
+	failing := func(ctx context.Context, logger *zap.Logger, manifest ArchiveManifest) (*ArchiveAuditIssue, error) {
+		return nil, errors.New("s3 unavailable")
+	}
+	_, err := VerifyArchive(archiveConfig, []Partition{{Name: "_y2024m04"}}, getManifest, failing, nil)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, false, errors.Is(err, ErrArchiveVerifyFailed))
+}
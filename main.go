@@ -2,70 +2,117 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-redis/redis/v9"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/config"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/eft/mockbank"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/cache"
 	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/db"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/kafka"
 	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/logz"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/scramkafka"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/secret"
+	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/internal/sftp"
 	"gitlab.com/prior-solution/aurora/standard-platform/common/reconcile_daily_batch/job"
 	"go.uber.org/zap"
-	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	env := os.Getenv("ENV")
-	if env == "" {
-		fmt.Println("LOCAL")
-		LambdaHandler()
-	} else {
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
 		lambda.Start(LambdaHandler)
+		return
 	}
-	//lambda.Start(LambdaHandler)
-
+	os.Exit(runCLI(os.Args[1:]))
 }
 
-func LambdaHandler() {
-	ctx := context.Background()
-
+// LambdaHandler runs the command named by the "mode" env var, archive when unset.
+func LambdaHandler() error {
 	config.InitTimeZone()
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel()
 
 	cfg, err := config.InitConfig()
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "Unable to initial config."))
+		return errors.Wrap(err, "Unable to initial config.")
 	}
+	return run(context.Background(), cfg)
+}
+
+func run(ctx context.Context, cfg *config.Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	logz.Init(cfg.Log.Level, cfg.Server.Name)
 	//defer logz.Drop()
-
-	ctx, cancel = context.WithCancel(ctx)
-	defer cancel()
 	logger := zap.L()
 
+	if cfg.Mode == "" {
+		cfg.Mode = commandArchive
+	}
+	if !isCommand(cfg.Mode) {
+		return usageErrorf("unknown command %q", cfg.Mode)
+	}
+
+	if cfg.Mode == commandMockBank {
+		return serveMockBank(ctx, logger, cfg.EFT.MockBank)
+	}
+
+	// Audit plans too: its last partition bounds the gap check.
+	var partitions []job.Partition
+	if cfg.Mode != commandPollInquiry && cfg.Mode != commandReconcileTransfers && cfg.Mode != commandPayout && cfg.Mode != commandRelayOutbox && cfg.Mode != commandSettlementReport {
+		var err error
+		partitions, err = job.PlanPartitions(cfg.Partition, time.Local, time.Now())
+		if err != nil {
+			return usageErrorf("invalid partition configuration: %v", err)
+		}
+	}
+
+	if cfg.Env != "" {
+		if err := secret.ConfigCommonSecret(cfg); err != nil {
+			return errors.Wrap(err, "Unable to initial common secret")
+		}
+	}
 	//if cfg.Env != "" {
-	//	err = secret.ConfigCommonSecret(cfg)
-	//	if err != nil {
-	//		log.Fatal(errors.Wrap(err, "Unable to initial common secret"))
-	//	}
 	//	err = secret.ConfigRDSSecret(cfg)
 	//	if err != nil {
 	//		log.Fatal(errors.Wrap(err, "Unable to initial rds secret"))
 	//	}
 	//}
 
-	jsonCfg, err := json.Marshal(cfg)
-	_ = jsonCfg
-	fmt.Println("after cfg : ", string(jsonCfg))
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(cfg.AWSConfig.Region),
+	})
+	if err != nil {
+		return errors.Wrap(err, "Unable to initial aws session.")
+	}
+	svc := s3.New(sess)
+	logger.Info("S3 CONNECT")
+
+	if cfg.Mode == commandListPartitions {
+		archiveExists := job.ArchiveExists(svc, cfg)
+		for _, partition := range partitions {
+			archived, err := archiveExists(ctx, logger, partition.Name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\t%s\t%s\tarchived=%t\n", partition.Name, partition.Start.Format(time.RFC3339), partition.End.Format(time.RFC3339), archived)
+		}
+		return nil
+	}
+
 	dbPool, err := db.Open(ctx, cfg.DBConfig)
 	if err != nil {
-		logger.Fatal("server connect to db", zap.Error(err))
+		return errors.Wrap(err, "server connect to db")
 	}
 	defer dbPool.Close()
 	logger.Info("DB CONNECT")
@@ -77,35 +124,419 @@ func LambdaHandler() {
 	//defer redisClient.Close()
 	//redisCmd := redisClient.CMD()
 
-	//
-	//internalProducer, err := scramkafka.NewSyncProducer(cfg.Kafka.Internal)
-	//if err != nil {
-	//	logger.Fatal("Fail Create NewSyncProducer", zap.Error(err))
-	//}
-	//defer func() {
-	//	if err = internalProducer.Close(); err != nil {
-	//		logger.Fatal("Fail Close SyncProducer", zap.Error(err))
-	//	}
-	//}()
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("ap-southeast-1"),
-	})
+	switch cfg.Mode {
+	case commandAudit:
+		publishers := []job.PublishAuditReportFunc{job.PutAuditReportToS3(svc, cfg)}
+		if cfg.Audit.StoreDB {
+			publishers = append(publishers, job.InsertAuditReport(dbPool))
+		}
+		if cfg.Audit.PublishKafka {
+			internalProducer, err := scramkafka.NewSyncProducer(cfg.Kafka.Internal)
+			if err != nil {
+				return errors.Wrap(err, "Fail Create NewSyncProducer")
+			}
+			defer func() {
+				if err = internalProducer.Close(); err != nil {
+					logger.Error("Fail Close SyncProducer", zap.Error(err))
+				}
+			}()
+			publishers = append(publishers, job.PublishAuditReportToKafka(kafka.NewSendMessageSyncWithTopic(internalProducer), cfg.Audit.Topic))
+		}
+		_, err = job.AuditArchive(
+			cfg,
+			job.ListArchiveObjects(svc, cfg),
+			job.GetArchiveManifest(svc, cfg),
+			job.VerifyArchiveObject(svc),
+			publishers...,
+		)
+	case commandRestore:
+		err = job.RestoreArchive(
+			cfg,
+			partitions,
+			job.DownloadArchive(svc, cfg, job.GetArchiveManifest(svc, cfg)),
+			job.RestorePartition(dbPool, cfg),
+		)
+	case commandVerify:
+		var getSourceDigest job.GetSourceDigestFunc
+		if cfg.Verify.Source {
+			getSourceDigest = job.GetSourceDigest(dbPool)
+		}
+		_, err = job.VerifyArchive(
+			cfg,
+			partitions,
+			job.GetArchiveManifest(svc, cfg),
+			job.VerifyArchiveObject(svc),
+			getSourceDigest,
+		)
+	case commandPollInquiry:
+		err = pollInquiry(ctx, logger, cfg, dbPool)
+	case commandReconcileTransfers:
+		err = reconcileTransfers(ctx, logger, cfg, svc, dbPool)
+	case commandPayout:
+		err = payout(ctx, logger, cfg, svc, dbPool)
+	case commandRelayOutbox:
+		err = relayOutbox(ctx, logger, cfg, dbPool)
+	case commandSettlementReport:
+		err = settlementReport(ctx, logger, cfg, svc, dbPool)
+	default:
+		err = job.BackUpHisPricing(
+			partitions,
+			job.GetDataHisPricing(dbPool, cfg),
+			job.PushToS3(svc, cfg),
+			job.PushRejectedRowsToS3(svc, cfg),
+			job.ReconcilePartition(dbPool, job.GetSourceDigest(dbPool), job.DownloadArchive(svc, cfg, job.GetArchiveManifest(svc, cfg))),
+			job.DetachPartitionHistory(dbPool),
+		)
+	}
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "Unable to initial config."))
-		return
+		logger.Error("error", zap.String("command", cfg.Mode), zap.Error(err))
+		return err
 	}
-	svc := s3.New(sess)
-	_ = svc
-	logger.Info("S3 CONNECT")
-	err = job.BackUpHisPricing(
-		job.GetDataHisPricing(dbPool),
-		job.PushToS3(svc, cfg),
-		job.DetachPartitionHistory(dbPool),
+
+	logger.Info("end", zap.String("command", cfg.Mode))
+	return nil
+}
+
+// pollInquiry resolves transfers left in SUBMITTED or UNKNOWN, once or every
+// cfg.EFT.Poller.Interval until the process is stopped.
+func pollInquiry(ctx context.Context, logger *zap.Logger, cfg *config.Config, dbPool *pgxpool.Pool) error {
+	redisCmd, closeRedis, err := eftRedis(ctx, logger, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeRedis()
+	client, closeClient, err := eftHTTPClient(ctx, logger, cfg, dbPool, redisCmd)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	retryPolicy := eft.NewRetryPolicy(cfg.EFT.Retry)
+	oauth := eft.HTTPOauthFundTransferHttp(client, cfg.EFT.OAuthURL, cfg.EFT.Timeout.OAuth, retryPolicy)
+
+	var escalations []eft.EscalateTransferFunc
+	if cfg.EFT.Poller.PublishKafka {
+		internalProducer, err := scramkafka.NewSyncProducer(cfg.Kafka.Internal)
+		if err != nil {
+			return errors.Wrap(err, "Fail Create NewSyncProducer")
+		}
+		defer func() {
+			if err = internalProducer.Close(); err != nil {
+				logger.Error("Fail Close SyncProducer", zap.Error(err))
+			}
+		}()
+		escalations = append(escalations, eft.PublishTransferExceptionToKafka(kafka.NewSendMessageSyncWithTopic(internalProducer), cfg.EFT.Poller.Topic))
+	}
+	// Last, so a transfer leaves polling only once every sink has it.
+	escalations = append(escalations, eft.EscalateTransfer(dbPool))
+
+	poll := eft.PollInquiry(
+		cfg.EFT.Poller,
+		eft.ListPendingTransfers(dbPool),
+		eft.ResolveTransfer(
+			cfg.EFT,
+			eft.CachedAccessToken(redisCmd, cfg.EFT, oauth),
+			eft.InvalidateCachedAccessToken(redisCmd),
+			eft.HTTPInquiryStatusFundTransfer(client, cfg.EFT.InquiryURL, cfg.EFT.Timeout.Inquiry, retryPolicy),
+			eft.TransitFundTransfer(dbPool),
+		),
+		eft.ScheduleInquiry(dbPool),
+		escalations...,
+	)
+	if cfg.EFT.Poller.Interval <= 0 {
+		_, err := poll(ctx, logger)
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return eft.RunInquiryPoller(ctx, logger, cfg.EFT.Poller.Interval, poll)
+}
+
+// reconcileTransfers matches the bank statement for cfg.EFT.Statement.Date,
+// yesterday when unset, against the recorded fund transfers.
+func reconcileTransfers(ctx context.Context, logger *zap.Logger, cfg *config.Config, svc *s3.S3, dbPool *pgxpool.Pool) error {
+	settlementDate := cfg.EFT.Statement.Date
+	if settlementDate == "" {
+		settlementDate = time.Now().AddDate(0, 0, -1).Format("20060102")
+	}
+	if _, err := time.Parse("20060102", settlementDate); err != nil {
+		return usageErrorf("invalid settlement date %q, expected 20060102", settlementDate)
+	}
+
+	sftpClient, err := newSFTPClient(cfg.EFT.SFTP)
+	if err != nil {
+		return err
+	}
+	defer sftpClient.Close()
+
+	_, err = eft.ReconcileStatement(
+		cfg.EFT.Statement,
+		eft.DownloadStatement(sftpClient, cfg.EFT.Statement),
+		eft.ListSettledTransfers(dbPool),
+		eft.InsertStatementReport(dbPool),
+		eft.PutStatementReportToS3(svc, cfg.S3Config.BucketName, cfg.EFT.Statement),
+	)(ctx, logger, settlementDate)
+	return err
+}
+
+// payout pays a batch of instructions from cfg.EFT.Payout.Source and writes
+// the result file next to the instruction file; db batches get it on S3.
+func payout(ctx context.Context, logger *zap.Logger, cfg *config.Config, svc *s3.S3, dbPool *pgxpool.Pool) error {
+	batchID := eft.PayoutBatchID(cfg.EFT.Payout)
+	if batchID == "" {
+		return usageErrorf("payout needs -payout-file or -batch-id")
+	}
+	if cfg.EFT.Payout.File == "" {
+		cfg.EFT.Payout.File = fmt.Sprintf("payout/%s.csv", batchID)
+	}
+
+	var getInstructions eft.GetPayoutInstructionsFunc
+	publishResult := eft.PutPayoutResultToS3(svc, cfg.S3Config.BucketName, cfg.EFT.Payout)
+	switch cfg.EFT.Payout.Source {
+	case "s3":
+		getInstructions = eft.GetPayoutFileFromS3(svc, cfg.S3Config.BucketName, cfg.EFT.Payout)
+	case "sftp":
+		sftpClient, err := newSFTPClient(cfg.EFT.SFTP)
+		if err != nil {
+			return err
+		}
+		defer sftpClient.Close()
+		getInstructions = eft.DownloadPayoutFile(sftpClient, cfg.EFT.Payout)
+		publishResult = eft.UploadPayoutResult(sftpClient, cfg.EFT.Payout)
+	case "db":
+		getInstructions = eft.ListPayoutInstructions(dbPool)
+	default:
+		return usageErrorf("unknown payout source %q, expected s3, sftp or db", cfg.EFT.Payout.Source)
+	}
+
+	redisCmd, closeRedis, err := eftRedis(ctx, logger, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeRedis()
+	client, closeClient, err := eftHTTPClient(ctx, logger, cfg, dbPool, redisCmd)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	retryPolicy := eft.NewRetryPolicy(cfg.EFT.Retry)
+	getAccessToken := eft.CachedAccessToken(redisCmd, cfg.EFT, eft.HTTPOauthFundTransferHttp(client, cfg.EFT.OAuthURL, cfg.EFT.Timeout.OAuth, retryPolicy))
+	invalidateAccessToken := eft.InvalidateCachedAccessToken(redisCmd)
+	inquiry := eft.HTTPInquiryStatusFundTransfer(client, cfg.EFT.InquiryURL, cfg.EFT.Timeout.Inquiry, retryPolicy)
+	transit := eft.TransitFundTransfer(dbPool)
+	getFundTransfer := eft.GetFundTransfer(dbPool)
+	transfer := eft.IdempotentTransfer(
+		redisCmd,
+		cfg.EFT,
+		eft.Transfer(
+			cfg.EFT,
+			getAccessToken,
+			invalidateAccessToken,
+			eft.HTTPVerifyDataFundTransfer(client, cfg.EFT.VerifyURL, cfg.EFT.Timeout.Verify, retryPolicy),
+			eft.HTTPFundTransfer(client, cfg.EFT.TransferURL, cfg.EFT.Timeout.Transfer),
+			inquiry,
+			eft.CreateFundTransfer(dbPool),
+			transit,
+		),
+		getFundTransfer,
+		eft.ResolveTransfer(cfg.EFT, getAccessToken, invalidateAccessToken, inquiry, transit),
 	)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	_, err = eft.Payout(
+		cfg.EFT.Payout,
+		getInstructions,
+		eft.ListPayoutLineStatus(dbPool),
+		transfer,
+		getFundTransfer,
+		eft.SavePayoutLine(dbPool),
+		publishResult,
+	)(ctx, logger, batchID)
+	return err
+}
+
+// settlementReport summarizes the fund transfers of cfg.EFT.Settlement.Date,
+// yesterday when unset, for finance.
+func settlementReport(ctx context.Context, logger *zap.Logger, cfg *config.Config, svc *s3.S3, dbPool *pgxpool.Pool) error {
+	businessDate := cfg.EFT.Settlement.Date
+	if businessDate == "" {
+		businessDate = time.Now().AddDate(0, 0, -1).Format("20060102")
+	}
+	if _, err := time.Parse("20060102", businessDate); err != nil {
+		return usageErrorf("invalid report date %q, expected 20060102", businessDate)
+	}
+
+	var publish eft.PublishSettlementSummaryFunc
+	switch cfg.EFT.Settlement.Destination {
+	case "s3":
+		publish = eft.PutSettlementSummaryToS3(svc, cfg.S3Config.BucketName, cfg.EFT.Settlement)
+	case "sftp":
+		sftpClient, err := newSFTPClient(cfg.EFT.SFTP)
+		if err != nil {
+			return err
+		}
+		defer sftpClient.Close()
+		publish = eft.UploadSettlementSummary(sftpClient, cfg.EFT.Settlement)
+	default:
+		return usageErrorf("unknown report destination %q, expected s3 or sftp", cfg.EFT.Settlement.Destination)
+	}
+
+	_, err := eft.SettlementReport(eft.ListDailyTransfers(dbPool), eft.ListOpenTransfers(dbPool), publish)(ctx, logger, businessDate)
+	return err
+}
+
+// relayOutbox publishes queued transfer events to Kafka, once or every
+// cfg.EFT.Outbox.Interval until the process is stopped.
+func relayOutbox(ctx context.Context, logger *zap.Logger, cfg *config.Config, dbPool *pgxpool.Pool) error {
+	if cfg.EFT.Outbox.Topic == "" {
+		return usageErrorf("relay-outbox needs -event-topic")
+	}
+	internalProducer, err := scramkafka.NewSyncProducer(cfg.Kafka.Internal)
+	if err != nil {
+		return errors.Wrap(err, "Fail Create NewSyncProducer")
+	}
+	defer func() {
+		if err = internalProducer.Close(); err != nil {
+			logger.Error("Fail Close SyncProducer", zap.Error(err))
+		}
+	}()
+
+	relay := eft.RelayOutbox(dbPool, cfg.EFT.Outbox, eft.PublishTransferEventToKafka(kafka.NewSendMessageSyncWithKey(internalProducer), cfg.EFT.Outbox.Topic))
+	if cfg.EFT.Outbox.Interval <= 0 {
+		_, err := relay(ctx, logger)
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return eft.RunOutboxRelay(ctx, logger, cfg.EFT.Outbox.Interval, relay)
+}
+
+// serveMockBank runs eft/mockbank until the process is stopped.
+func serveMockBank(ctx context.Context, logger *zap.Logger, cfg config.MockBankConfig) error {
+	bank := mockbank.New(mockbank.Scenario{})
+	if cfg.Script != "" {
+		data, err := os.ReadFile(cfg.Script)
+		if err != nil {
+			return usageErrorf("unable to read mock bank script: %v", err)
+		}
+		if bank, err = mockbank.NewFromScript(data); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+
+	server := &http.Server{Addr: cfg.Addr, Handler: bank}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	logger.Info("mock bank listening", zap.String("addr", cfg.Addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// eftRedis connects the Redis shared by the eft token cache and, when
+// enabled, the rate limiter; the returned func closes it.
+func eftRedis(ctx context.Context, logger *zap.Logger, cfg *config.Config) (redis.Cmdable, func(), error) {
+	redisClient, err := cache.Initialize(ctx, cfg.RedisConfig)
 	if err != nil {
-		logger.Error("error", zap.Error(err))
-		panic(err)
+		return nil, nil, errors.Wrap(err, "Error cannot connect redis.")
+	}
+	return redisClient.CMD(), func() {
+		if err := redisClient.Close(); err != nil {
+			logger.Error("Fail Close redis", zap.Error(err))
+		}
+	}, nil
+}
+
+// eftHTTPClient talks to the bank or, when the EFT test toggle is on, to the
+// in-process mock bank, pointing cfg's endpoint URLs at it. Either way calls go
+// through the rate limiter and circuit breaker and are written to the audit
+// log; the returned func releases the Kafka connection behind them.
+func eftHTTPClient(ctx context.Context, logger *zap.Logger, cfg *config.Config, dbPool *pgxpool.Pool, redisCmd redis.Cmdable) (*http.Client, func(), error) {
+	if err := eft.SetResponseCodes(cfg.EFT.ResponseCodes); err != nil {
+		return nil, nil, errors.Wrap(err, "Invalid eft response codes")
+	}
+	var client *http.Client
+	if cfg.EFT.Toggle.IsTest {
+		bank, err := mockbank.FromToggle(cfg.EFT.Toggle)
+		if err != nil {
+			return nil, nil, err
+		}
+		mockbank.Configure(&cfg.EFT, "http://mockbank")
+		client = bank.Client(cfg.EFT.HTTP.TimeOut)
+	} else {
+		var err error
+		if client, err = eft.NewHTTPClient(cfg.EFT.HTTP, logger); err != nil {
+			return nil, nil, errors.Wrap(err, "Unable to build eft http client")
+		}
+		go eft.WatchCertExpiry(ctx, logger, cfg.EFT.HTTP)
+	}
+
+	var closers []func()
+	closeClient := func() {
+		for _, release := range closers {
+			release()
+		}
+	}
+
+	var auditLogs []eft.WriteAuditLogFunc
+	if cfg.EFT.AuditLog.StoreDB {
+		auditLogs = append(auditLogs, eft.InsertAuditLog(dbPool))
+	}
+	if cfg.EFT.AuditLog.PublishKafka {
+		internalProducer, err := scramkafka.NewSyncProducer(cfg.Kafka.Internal)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Fail Create NewSyncProducer")
+		}
+		closers = append(closers, func() {
+			if err := internalProducer.Close(); err != nil {
+				logger.Error("Fail Close SyncProducer", zap.Error(err))
+			}
+		})
+		auditLogs = append(auditLogs, eft.PublishAuditLogToKafka(kafka.NewSendMessageSyncWithKey(internalProducer), cfg.EFT.AuditLog.Topic))
+	}
+
+	limit := eft.TokenBucket(cfg.EFT.Limiter.RatePerSecond, cfg.EFT.Limiter.Burst)
+	if cfg.EFT.Limiter.Redis {
+		limit = eft.RedisRateLimit(cache.InCrRedis(redisCmd), cache.SetExpire(redisCmd), cfg.EFT.Limiter.RatePerSecond, limit)
+	}
+	transport := client.Transport
+	if cfg.EFT.Signing.Enabled {
+		if cfg.EFT.Toggle.IsTest {
+			logger.Warn("eft signing skipped, mock bank does not sign")
+		} else {
+			sign, verify, err := eft.JOSESigner(cfg.EFT.Signing, []byte(cfg.Secret.Private))
+			if err != nil {
+				closeClient()
+				return nil, nil, errors.Wrap(err, "Unable to build eft signer")
+			}
+			transport = eft.SigningTransport(transport, sign, verify, logger)
+		}
 	}
+	if len(auditLogs) > 0 {
+		transport = eft.AuditTransport(transport, logger, cfg.EFT.AuditLog.Timeout, auditLogs...)
+	}
+	client.Transport = eft.GatewayTransport(transport, limit, eft.NewCircuitBreaker(cfg.EFT.Breaker, logger), logger)
+	return client, closeClient, nil
+}
 
-	fmt.Print("end ")
+func newSFTPClient(cfg config.SFTPConfig) (*sftp.Client, error) {
+	client, err := sftp.New(sftp.Config{
+		Username:   cfg.Username,
+		Password:   cfg.Password,
+		PrivateKey: cfg.PrivateKey,
+		Server:     cfg.Server,
+		Timeout:    cfg.Timeout,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to connect sftp")
+	}
+	return client, nil
 }
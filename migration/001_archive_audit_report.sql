@@ -0,0 +1,11 @@
+create table if not exists archive_audit_report
+(
+    id          bigserial primary key,
+    bucket      varchar(255) not null,
+    prefix      varchar(255) not null,
+    started_at  timestamptz  not null,
+    finished_at timestamptz  not null,
+    ok          boolean      not null,
+    report      jsonb        not null,
+    created_at  timestamptz  not null default now()
+);
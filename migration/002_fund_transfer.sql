@@ -0,0 +1,28 @@
+create table if not exists fund_transfer
+(
+    merchant_trans_id varchar(64) primary key,
+    merchant_id       varchar(64)    not null,
+    rs_trans_id       varchar(64),
+    status            varchar(16)    not null,
+    amount            numeric(18, 2),
+    to_bank_code      varchar(8),
+    settlement_date   varchar(8),
+    fail_msg          text,
+    created_at        timestamptz    not null default now(),
+    updated_at        timestamptz    not null default now()
+);
+
+create index if not exists fund_transfer_status_updated_at_idx on fund_transfer (status, updated_at);
+
+create table if not exists fund_transfer_transition
+(
+    id                bigserial primary key,
+    merchant_trans_id varchar(64) not null references fund_transfer (merchant_trans_id),
+    from_status       varchar(16),
+    to_status         varchar(16) not null,
+    request           jsonb,
+    response          jsonb,
+    created_at        timestamptz not null default now()
+);
+
+create index if not exists fund_transfer_transition_merchant_trans_id_idx on fund_transfer_transition (merchant_trans_id);
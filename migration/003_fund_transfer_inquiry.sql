@@ -0,0 +1,12 @@
+alter table fund_transfer add column if not exists inquiry_attempts integer not null default 0;
+alter table fund_transfer add column if not exists next_inquiry_at timestamptz;
+alter table fund_transfer add column if not exists escalated_at timestamptz;
+
+create table if not exists fund_transfer_exception
+(
+    merchant_trans_id varchar(64) primary key references fund_transfer (merchant_trans_id),
+    status            varchar(16) not null,
+    inquiry_attempts  integer     not null,
+    reason            text        not null,
+    created_at        timestamptz not null default now()
+);
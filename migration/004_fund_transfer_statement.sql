@@ -0,0 +1,14 @@
+create table if not exists fund_transfer_statement_recon
+(
+    id                bigserial primary key,
+    settlement_date   varchar(8)  not null,
+    bucket            varchar(24) not null,
+    merchant_trans_id varchar(64),
+    rs_trans_id       varchar(64),
+    our_status        varchar(16),
+    our_amount        numeric(18, 2),
+    bank_amount       numeric(18, 2),
+    created_at        timestamptz not null default now()
+);
+
+create index if not exists fund_transfer_statement_recon_settlement_date_idx on fund_transfer_statement_recon (settlement_date, bucket);
@@ -0,0 +1,34 @@
+create table if not exists payout_instruction
+(
+    batch_id          varchar(64)    not null,
+    line_no           integer        not null,
+    merchant_trans_id varchar(64)    not null,
+    proxy_type        varchar(16)    not null,
+    proxy_value       varchar(64)    not null,
+    from_account_no   varchar(32),
+    trans_type        varchar(16),
+    sender_name       varchar(256),
+    sender_tax_id     varchar(32),
+    to_bank_code      varchar(8)     not null,
+    amount            numeric(18, 2) not null,
+    type_of_sender    varchar(16),
+    created_at        timestamptz    not null default now(),
+    primary key (batch_id, line_no)
+);
+
+create table if not exists payout_line
+(
+    batch_id          varchar(64) not null,
+    line_no           integer     not null,
+    merchant_trans_id varchar(64) not null,
+    amount            numeric(18, 2),
+    status            varchar(16) not null,
+    rs_trans_id       varchar(64),
+    settlement_date   varchar(8),
+    fail_msg          text,
+    created_at        timestamptz not null default now(),
+    updated_at        timestamptz not null default now(),
+    primary key (batch_id, line_no)
+);
+
+create index if not exists payout_line_status_idx on payout_line (batch_id, status);
@@ -0,0 +1,32 @@
+create table if not exists fund_transfer_audit_log
+(
+    id                bigserial primary key,
+    endpoint          varchar(128) not null,
+    method            varchar(8)   not null,
+    merchant_trans_id varchar(64),
+    rs_trans_id       varchar(64),
+    status_code       integer,
+    response_code     varchar(8),
+    latency_ms        bigint       not null,
+    error             text,
+    request           jsonb,
+    response          jsonb,
+    created_at        timestamptz  not null default now()
+);
+
+create index if not exists fund_transfer_audit_log_merchant_trans_id_idx on fund_transfer_audit_log (merchant_trans_id);
+
+-- The audit trail is append-only.
+create or replace function fund_transfer_audit_log_append_only() returns trigger as
+$$
+begin
+    raise exception 'fund_transfer_audit_log is append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists fund_transfer_audit_log_append_only on fund_transfer_audit_log;
+create trigger fund_transfer_audit_log_append_only
+    before update or delete
+    on fund_transfer_audit_log
+    for each row
+execute function fund_transfer_audit_log_append_only();
@@ -0,0 +1,15 @@
+create table if not exists fund_transfer_outbox
+(
+    id                bigserial primary key,
+    event_id          uuid        not null unique,
+    merchant_trans_id varchar(64) not null references fund_transfer (merchant_trans_id),
+    event_type        varchar(64) not null,
+    version           integer     not null,
+    payload           jsonb       not null,
+    attempts          integer     not null default 0,
+    last_error        text,
+    created_at        timestamptz not null default now(),
+    published_at      timestamptz
+);
+
+create index if not exists fund_transfer_outbox_unpublished_idx on fund_transfer_outbox (id) where published_at is null;
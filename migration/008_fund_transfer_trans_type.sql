@@ -0,0 +1,12 @@
+alter table fund_transfer add column if not exists trans_type varchar(16);
+
+-- Backfill from the request recorded with the INITIATED transition.
+update fund_transfer f
+set trans_type = t.request ->> 'transType'
+from fund_transfer_transition t
+where t.merchant_trans_id = f.merchant_trans_id
+  and t.from_status is null
+  and f.trans_type is null
+  and coalesce(t.request ->> 'transType', '') <> '';
+
+create index if not exists fund_transfer_settlement_date_idx on fund_transfer (settlement_date);
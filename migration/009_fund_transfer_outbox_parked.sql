@@ -0,0 +1,4 @@
+alter table fund_transfer_outbox add column if not exists parked_at timestamptz;
+
+-- Parked events hold back their transfer's later events until replayed.
+create index if not exists fund_transfer_outbox_parked_idx on fund_transfer_outbox (merchant_trans_id) where parked_at is not null and published_at is null;